@@ -0,0 +1,140 @@
+package gowebsocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAckWindowBlocksUntilAck(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.AckWindow = 2
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	socket.SendText("1")
+	socket.SendText("2")
+
+	sent := make(chan error, 1)
+	go func() { sent <- socket.SendText("3") }()
+	select {
+	case err := <-sent:
+		t.Fatalf("third send returned %v with the window full", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	socket.Ack(1)
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send still blocked after Ack freed a slot")
+	}
+	if id := socket.LastSentID(); id != 3 {
+		t.Fatalf("LastSentID = %d, want 3", id)
+	}
+}
+
+func TestAckWindowClose(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.AckWindow = 1
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	socket.SendText("1")
+
+	sent := make(chan error, 1)
+	go func() { sent <- socket.SendText("2") }()
+	time.Sleep(50 * time.Millisecond)
+	socket.Close()
+	select {
+	case err := <-sent:
+		if err != ErrClosed {
+			t.Fatalf("blocked send returned %v, want ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send still blocked after Close")
+	}
+}
+
+func TestAckWindowBatch(t *testing.T) {
+	received := make(chan string, 4)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+	socket := New(url)
+	socket.AckWindow = 2
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	sent := make(chan error, 1)
+	go func() { sent <- socket.SendTextBatch([]string{"1", "2", "3", "4"}) }()
+	for id := uint64(1); id <= 4; id++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %d not received", id)
+		}
+		if id < 2 {
+			continue
+		}
+		select {
+		case message := <-received:
+			t.Fatalf("%q written with the window full", message)
+		case <-time.After(50 * time.Millisecond):
+		}
+		socket.Ack(id - 1)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAckWindowSendWriter(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.AckWindow = 1
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	socket.SendText("1")
+
+	opened := make(chan error, 1)
+	go func() {
+		writer, err := socket.SendWriter(websocket.TextMessage)
+		if err == nil {
+			writer.Write([]byte("2"))
+			err = writer.Close()
+		}
+		opened <- err
+	}()
+	select {
+	case err := <-opened:
+		t.Fatalf("SendWriter returned %v with the window full", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	socket.Ack(1)
+	select {
+	case err := <-opened:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SendWriter still blocked after Ack freed a slot")
+	}
+}
@@ -0,0 +1,74 @@
+package gowebsocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestActiveSocketsOpenAndClose(t *testing.T) {
+	_, url := startServer(t, echo)
+	before := ActiveSockets()
+	sockets := make([]Socket, 5)
+	for i := range sockets {
+		sockets[i] = New(url)
+		if err := sockets[i].Connect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := ActiveSockets() - before; n != len(sockets) {
+		t.Fatalf("%d sockets counted after connecting, want %d", n, len(sockets))
+	}
+	for i := range sockets {
+		sockets[i].Close()
+	}
+	if n := ActiveSockets() - before; n != 0 {
+		t.Fatalf("%d sockets still counted after closing", n)
+	}
+}
+
+func TestActiveSocketsAfterGivingUp(t *testing.T) {
+	server, url := startServer(t, func(conn *websocket.Conn) {})
+	before := ActiveSockets()
+	socket := New(url)
+	socket.ReconnectionOptions.Times = 2
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	socket.OnDisconnected = func(err error, socket *Socket) { server.Listener.Close() }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	waitUntil(t, "the socket did not give up reconnecting", func() bool {
+		return len(socket.AttemptHistory()) == 3
+	})
+	socket.Wait()
+	if n := ActiveSockets() - before; n != 0 {
+		t.Fatalf("%d sockets still counted after giving up", n)
+	}
+}
+
+func TestActiveSocketsManualReconnect(t *testing.T) {
+	_, url := startServer(t, dropFirst())
+	before := ActiveSockets()
+	socket := New(url)
+	socket.ManualReconnect = true
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	disconnected := make(chan struct{}, 1)
+	socket.OnDisconnected = func(err error, socket *Socket) { disconnected <- struct{}{} }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	<-disconnected
+	socket.Wait()
+	if n := ActiveSockets() - before; n != 0 {
+		t.Fatalf("%d sockets counted while waiting for a manual reconnect", n)
+	}
+	if err := socket.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if n := ActiveSockets() - before; n != 1 {
+		t.Fatalf("%d sockets counted after reconnecting, want 1", n)
+	}
+}
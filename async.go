@@ -0,0 +1,70 @@
+package gowebsocket
+
+// asyncQueueSize bounds the sends queued by SendAsync before it blocks.
+const asyncQueueSize = 256
+
+type asyncSend struct {
+	messageType int
+	data        []byte
+	done        func(error)
+}
+
+// SendAsync queues a text or binary message and returns without waiting for
+// it to be written. done, if not nil, is called exactly once with the
+// outcome SendText or SendBinary would have returned, including a retry
+// after reconnecting. Queued messages are sent in order from a single
+// goroutine. SendAsync only blocks when asyncQueueSize messages are already
+// waiting. Messages still queued when the socket is closed, or queued after
+// it, complete with ErrClosed.
+func (socket *Socket) SendAsync(messageType int, data []byte, done func(error)) {
+	socket.asyncOnce.Do(func() {
+		go socket.sendAsyncLoop()
+	})
+	message := asyncSend{messageType, data, done}
+
+	socket.asyncMu.Lock()
+	queued := false
+	if !socket.isClosed() {
+		select {
+		case socket.async <- message:
+			queued = true
+		case <-socket.done:
+		}
+	}
+	socket.asyncMu.Unlock()
+	if !queued {
+		message.complete(ErrClosed)
+	}
+}
+
+func (socket *Socket) sendAsyncLoop() {
+	for {
+		select {
+		case message := <-socket.async:
+			err := socket.send(message.messageType, message.data)
+			if err != nil {
+				socket.log.error("write:", err)
+			}
+			message.complete(err)
+		case <-socket.done:
+			// Holding asyncMu keeps SendAsync from queueing behind the
+			// drain.
+			socket.asyncMu.Lock()
+			var pending []asyncSend
+			for len(socket.async) > 0 {
+				pending = append(pending, <-socket.async)
+			}
+			socket.asyncMu.Unlock()
+			for _, message := range pending {
+				message.complete(ErrClosed)
+			}
+			return
+		}
+	}
+}
+
+func (message asyncSend) complete(err error) {
+	if message.done != nil {
+		message.done(err)
+	}
+}
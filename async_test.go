@@ -0,0 +1,93 @@
+package gowebsocket
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// completions records every call of the done callbacks it hands out.
+type completions struct {
+	mu    sync.Mutex
+	calls map[int][]error
+}
+
+func (c *completions) done(i int) func(error) {
+	return func(err error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.calls == nil {
+			c.calls = make(map[int][]error)
+		}
+		c.calls[i] = append(c.calls[i], err)
+	}
+}
+
+// expect waits for n messages to complete, then checks that each completed
+// exactly once with want.
+func (c *completions) expect(t *testing.T, n int, want error) {
+	t.Helper()
+	waitUntil(t, "completions", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.calls) == n
+	})
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; i < n; i++ {
+		if calls := c.calls[i]; len(calls) != 1 || calls[0] != want {
+			t.Errorf("message %d completed with %v, want %v once", i, calls, want)
+		}
+	}
+}
+
+func TestSendAsyncSucceeds(t *testing.T) {
+	conn := newMockConn()
+	socket := New("ws://127.0.0.1:1")
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	var done completions
+	for i := 0; i < 3; i++ {
+		socket.SendAsync(websocket.TextMessage, []byte{'0' + byte(i)}, done.done(i))
+	}
+	done.expect(t, 3, nil)
+	writes := conn.writes()
+	if len(writes) != 3 {
+		t.Fatalf("%d messages written, want 3", len(writes))
+	}
+	for i, message := range writes {
+		if string(message.data) != string('0'+rune(i)) {
+			t.Fatalf("message %d is %q, out of order", i, message.data)
+		}
+	}
+}
+
+func TestSendAsyncFails(t *testing.T) {
+	conn := newMockConn()
+	rejected := errors.New("rejected")
+	conn.writeErr = rejected
+	socket := New("ws://127.0.0.1:1")
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	var done completions
+	for i := 0; i < 3; i++ {
+		socket.SendAsync(websocket.BinaryMessage, []byte{byte(i)}, done.done(i))
+	}
+	done.expect(t, 3, rejected)
+}
+
+func TestSendAsyncAfterClose(t *testing.T) {
+	socket := New("ws://127.0.0.1:1")
+	useConn(&socket, newMockConn())
+	socket.Close()
+
+	var done completions
+	socket.SendAsync(websocket.TextMessage, []byte("late"), done.done(0))
+	done.expect(t, 1, ErrClosed)
+}
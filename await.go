@@ -0,0 +1,44 @@
+package gowebsocket
+
+import "context"
+
+type firstMessage struct {
+	messageType int
+	data        []byte
+}
+
+// ConnectAndAwaitFirst connects and waits for the first text or binary
+// message, returning its payload and type. That message is consumed here and
+// not passed to the message callbacks. If ctx expires before the message
+// arrives, the socket is closed and the context error returned.
+func (socket *Socket) ConnectAndAwaitFirst(ctx context.Context) ([]byte, int, error) {
+	first := make(chan firstMessage, 1)
+	socket.handlerMu.Lock()
+	socket.firstMessage = first
+	socket.handlerMu.Unlock()
+
+	if err := socket.doConnect(ctx, 0); err != nil {
+		socket.takeFirstMessage()
+		return nil, 0, err
+	}
+	socket.start(nil)
+
+	select {
+	case message := <-first:
+		return message.data, message.messageType, nil
+	case <-ctx.Done():
+		socket.takeFirstMessage()
+		socket.Close()
+		return nil, 0, ctx.Err()
+	}
+}
+
+// takeFirstMessage clears and returns the pending ConnectAndAwaitFirst
+// channel, so only one message is ever delivered to it.
+func (socket *Socket) takeFirstMessage() chan<- firstMessage {
+	socket.handlerMu.Lock()
+	defer socket.handlerMu.Unlock()
+	first := socket.firstMessage
+	socket.firstMessage = nil
+	return first
+}
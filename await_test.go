@@ -0,0 +1,63 @@
+package gowebsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectAndAwaitFirst(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.BinaryMessage, []byte("welcome"))
+		echo(conn)
+	})
+	socket := New(url)
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	socket.OnBinaryMessage = func(data []byte, socket *Socket) {
+		t.Errorf("greeting %q also passed to OnBinaryMessage", data)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data, messageType, err := socket.ConnectAndAwaitFirst(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	if string(data) != "welcome" || messageType != websocket.BinaryMessage {
+		t.Fatalf("got %q of type %d, want the binary greeting", data, messageType)
+	}
+
+	// Later messages go to the callbacks as usual.
+	socket.SendText("hello")
+	select {
+	case message := <-received:
+		if message != "hello" {
+			t.Fatalf("OnTextMessage got %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message after the greeting")
+	}
+}
+
+func TestConnectAndAwaitFirstTimeout(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := socket.ConnectAndAwaitFirst(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("returned after %v", elapsed)
+	}
+	if state := socket.State(); state != StateClosed {
+		t.Fatalf("state is %v, want StateClosed", state)
+	}
+}
@@ -0,0 +1,57 @@
+package gowebsocket
+
+import (
+	"context"
+	"sync"
+)
+
+// readyBarrier releases every waiter at once when the connection becomes
+// ready and is re-armed when it drops, unlike a one-shot channel.
+type readyBarrier struct {
+	mu    sync.Mutex
+	ready chan struct{}
+	open  bool
+}
+
+func newReadyBarrier() *readyBarrier {
+	return &readyBarrier{ready: make(chan struct{})}
+}
+
+func (barrier *readyBarrier) release() {
+	barrier.mu.Lock()
+	if !barrier.open {
+		close(barrier.ready)
+		barrier.open = true
+	}
+	barrier.mu.Unlock()
+}
+
+func (barrier *readyBarrier) rearm() {
+	barrier.mu.Lock()
+	if barrier.open {
+		barrier.ready = make(chan struct{})
+		barrier.open = false
+	}
+	barrier.mu.Unlock()
+}
+
+func (barrier *readyBarrier) wait() <-chan struct{} {
+	barrier.mu.Lock()
+	defer barrier.mu.Unlock()
+	return barrier.ready
+}
+
+// WaitForConnection blocks until the socket is connected, returning
+// immediately if it already is. All concurrent callers are released together
+// and later calls block again after a disconnect. It returns ErrClosed if the
+// socket is closed for good, or the context's error.
+func (socket *Socket) WaitForConnection(ctx context.Context) error {
+	select {
+	case <-socket.ready.wait():
+		return nil
+	case <-socket.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,86 @@
+package gowebsocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWaitForConnectionReleasesAllWaiters(t *testing.T) {
+	var accept int32 = 1
+	drop := make(chan struct{})
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&accept) == 0 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		<-drop
+	}))
+	defer server.Close()
+	defer close(drop)
+
+	socket := New("ws" + strings.TrimPrefix(server.URL, "http"))
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	socket.ReconnectionOptions.MaxInterval = 5 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const waiters = 5
+	released := make(chan error, waiters)
+	wait := func() {
+		for i := 0; i < waiters; i++ {
+			go func() { released <- socket.WaitForConnection(ctx) }()
+		}
+	}
+	expectBlocked := func() {
+		t.Helper()
+		select {
+		case err := <-released:
+			t.Fatalf("waiter released while disconnected: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	expectReleased := func() {
+		t.Helper()
+		for i := 0; i < waiters; i++ {
+			select {
+			case err := <-released:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("only %d of %d waiters released", i, waiters)
+			}
+		}
+	}
+
+	wait()
+	expectBlocked()
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	expectReleased()
+
+	// Drop the connection and refuse reconnects until the waiters are
+	// blocked again.
+	atomic.StoreInt32(&accept, 0)
+	drop <- struct{}{}
+	waitUntil(t, "disconnect", func() bool { return !socket.IsConnected() })
+	wait()
+	expectBlocked()
+	atomic.StoreInt32(&accept, 1)
+	expectReleased()
+}
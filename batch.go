@@ -0,0 +1,64 @@
+package gowebsocket
+
+// maxBatchSize bounds both the number of messages passed to a single OnBatch
+// call and how many may be queued before the read loop waits for it.
+const maxBatchSize = 256
+
+// Message is a received data frame.
+type Message struct {
+	Type int // websocket.TextMessage or websocket.BinaryMessage
+	Data []byte
+}
+
+// queueBatch hands message to the batch dispatcher, starting it on first
+// use. It blocks while the queue is full, unless the socket is closed.
+func (socket *Socket) queueBatch(message Message) {
+	socket.batchOnce.Do(func() {
+		go socket.dispatchBatches()
+	})
+	select {
+	case socket.batch <- message:
+		socket.batchSizes.add(len(message.Data))
+	case <-socket.done:
+	}
+}
+
+// dispatchBatches waits for a message, drains whatever else is already
+// queued behind it and passes them all to OnBatch in a single call. Once the
+// socket is closed it delivers what is still queued and returns.
+func (socket *Socket) dispatchBatches() {
+	for {
+		select {
+		case message := <-socket.batch:
+			socket.deliverBatch(socket.drainBatch(append(make([]Message, 0, maxBatchSize), message)))
+		case <-socket.done:
+			for {
+				messages := socket.drainBatch(nil)
+				if len(messages) == 0 {
+					return
+				}
+				socket.deliverBatch(messages)
+			}
+		}
+	}
+}
+
+// drainBatch appends the messages already queued to messages, up to
+// maxBatchSize, without waiting for more.
+func (socket *Socket) drainBatch(messages []Message) []Message {
+	for len(messages) < maxBatchSize {
+		select {
+		case message := <-socket.batch:
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+	return messages
+}
+
+func (socket *Socket) deliverBatch(messages []Message) {
+	if current := socket.snapshot(); current.OnBatch != nil {
+		socket.safely("OnBatch", func() { current.OnBatch(messages, socket) })
+	}
+}
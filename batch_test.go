@@ -0,0 +1,112 @@
+package gowebsocket
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBatchPreservesOrder(t *testing.T) {
+	const count = 2000
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < count; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(strconv.Itoa(i)))
+		}
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	// The batch queue must not keep pointers into reused buffers.
+	socket.ReuseReceiveBuffers = true
+	var mu sync.Mutex
+	var received []string
+	calls := 0
+	done := make(chan struct{})
+	socket.OnBatch = func(messages []Message, socket *Socket) {
+		if len(messages) > maxBatchSize {
+			t.Errorf("batch of %d messages, want at most %d", len(messages), maxBatchSize)
+		}
+		mu.Lock()
+		calls++
+		for _, message := range messages {
+			received = append(received, string(message.Data))
+		}
+		finished := len(received) == count
+		mu.Unlock()
+		if finished {
+			close(done)
+		}
+		// Give the read loop time to queue more than one message.
+		time.Sleep(time.Millisecond)
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		mu.Lock()
+		defer mu.Unlock()
+		t.Fatalf("received %d of %d messages", len(received), count)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, message := range received {
+		if message != strconv.Itoa(i) {
+			t.Fatalf("message %d is %q", i, message)
+		}
+	}
+	if calls == count {
+		t.Error("every message was delivered in a batch of its own")
+	}
+}
+
+func TestBatchDeliveredAfterClose(t *testing.T) {
+	const count = 100
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < count; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(strconv.Itoa(i)))
+		}
+	})
+	socket := New(url)
+	socket.ReconnectionOptions.Times = -1
+	var mu sync.Mutex
+	received := 0
+	socket.OnBatch = func(messages []Message, socket *Socket) {
+		// Slow enough for messages to still be queued when the server
+		// hangs up and the socket closes.
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		received += len(messages)
+		mu.Unlock()
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := received
+		mu.Unlock()
+		if n == count {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d of %d messages", n, count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state := socket.State(); state != StateClosed {
+		t.Errorf("state is %v, want StateClosed", state)
+	}
+}
+
+func BenchmarkReceiveBatched(b *testing.B) {
+	benchmarkReceive(b, func(socket *Socket, received func(int)) {
+		socket.OnBatch = func(messages []Message, socket *Socket) { received(len(messages)) }
+	})
+}
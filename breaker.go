@@ -0,0 +1,43 @@
+package gowebsocket
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops reconnecting for Cooldown once MaxReconnects attempts
+// have been made within Window. A zero MaxReconnects disables it.
+type CircuitBreaker struct {
+	MaxReconnects int
+	Window        time.Duration
+	Cooldown      time.Duration
+}
+
+type circuitBreakerState struct {
+	mu       sync.Mutex
+	attempts []time.Time
+}
+
+// trip records a reconnect attempt and reports whether the breaker opened,
+// in which case the attempt history is reset for the next window.
+func (state *circuitBreakerState) trip(breaker CircuitBreaker, now time.Time) bool {
+	if breaker.MaxReconnects <= 0 {
+		return false
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	recent := state.attempts[:0]
+	for _, attempt := range state.attempts {
+		if now.Sub(attempt) < breaker.Window {
+			recent = append(recent, attempt)
+		}
+	}
+	state.attempts = recent
+	if len(state.attempts) >= breaker.MaxReconnects {
+		state.attempts = state.attempts[:0]
+		return true
+	}
+	state.attempts = append(state.attempts, now)
+	return false
+}
@@ -0,0 +1,53 @@
+package gowebsocket
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCircuitBreakerPausesReconnecting(t *testing.T) {
+	// Every connection is dropped as soon as it is up.
+	_, url := startServer(t, func(conn *websocket.Conn) {})
+	const cooldown = 200 * time.Millisecond
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	socket.ReconnectionOptions.CircuitBreaker = CircuitBreaker{MaxReconnects: 3, Window: time.Minute, Cooldown: cooldown}
+	var mu sync.Mutex
+	var attempts []time.Time
+	var opened time.Time
+	socket.OnReconnecting = func(attempt int, socket *Socket) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		mu.Unlock()
+	}
+	socket.OnCircuitOpen = func(socket *Socket) {
+		mu.Lock()
+		if opened.IsZero() {
+			opened = time.Now()
+		}
+		mu.Unlock()
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	waitUntil(t, "no attempt after the breaker opened", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return !opened.IsZero() && len(attempts) > 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for i, attempt := range attempts[:3] {
+		if attempt.After(opened) {
+			t.Fatalf("breaker opened after %d attempts, want 3", i)
+		}
+	}
+	if paused := attempts[3].Sub(opened); paused < cooldown {
+		t.Fatalf("reconnected %v after the breaker opened, want at least %v", paused, cooldown)
+	}
+}
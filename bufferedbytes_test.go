@@ -0,0 +1,65 @@
+package gowebsocket
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBufferedBytesSendQueue(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.SendQueueSize = 5
+	for _, size := range []int{5, 10, 20} {
+		if err := socket.SendText(strings.Repeat("x", size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, tx := socket.BufferedBytes(); tx != 35 {
+		t.Fatalf("tx = %d with 35 bytes queued", tx)
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	if _, tx := socket.BufferedBytes(); tx != 0 {
+		t.Fatalf("tx = %d after the queue was flushed", tx)
+	}
+}
+
+func TestBufferedBytesMessages(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		for _, size := range []int{100, 200, 300} {
+			conn.WriteMessage(websocket.BinaryMessage, make([]byte, size))
+		}
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	messages := socket.Messages()
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	waitUntil(t, "messages not buffered", func() bool { return len(messages) == 3 })
+	if rx, _ := socket.BufferedBytes(); rx != 600 {
+		t.Fatalf("rx = %d with 600 bytes buffered", rx)
+	}
+	<-messages
+	if rx, _ := socket.BufferedBytes(); rx != 500 {
+		t.Fatalf("rx = %d after reading the first message, want 500", rx)
+	}
+}
+
+func TestBufferedSizesWrap(t *testing.T) {
+	buffered := newBufferedSizes(3)
+	for size := 1; size <= 5; size++ {
+		buffered.add(size)
+	}
+	if n := buffered.total(2); n != 9 {
+		t.Fatalf("total of the last two = %d, want 9", n)
+	}
+	if n := buffered.total(3); n != 12 {
+		t.Fatalf("total of the last three = %d, want 12", n)
+	}
+}
@@ -0,0 +1,47 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxPooledBufferSize keeps unusually large frames from pinning memory in the
+// pool.
+const maxPooledBufferSize = 1 << 20
+
+var receiveBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getReceiveBuffer() *bytes.Buffer {
+	buffer := receiveBufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+	return buffer
+}
+
+func putReceiveBuffer(buffer *bytes.Buffer) {
+	if buffer == nil || buffer.Cap() > maxPooledBufferSize {
+		return
+	}
+	receiveBufferPool.Put(buffer)
+}
+
+// writeBufferPools holds the pools used with ConnectionOptions.PoolWriteBuffers,
+// one per write buffer size as gorilla requires.
+var writeBufferPools = struct {
+	mu    sync.Mutex
+	pools map[int]*sync.Pool
+}{pools: make(map[int]*sync.Pool)}
+
+func writeBufferPool(size int) websocket.BufferPool {
+	writeBufferPools.mu.Lock()
+	defer writeBufferPools.mu.Unlock()
+	pool, ok := writeBufferPools.pools[size]
+	if !ok {
+		pool = &sync.Pool{}
+		writeBufferPools.pools[size] = pool
+	}
+	return pool
+}
@@ -0,0 +1,50 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestReuseReceiveBuffers checks that pooled buffers handed from message to
+// message never carry another message's bytes.
+func TestReuseReceiveBuffers(t *testing.T) {
+	const count = 500
+	pattern := func(i int) []byte { return bytes.Repeat([]byte{byte(i)}, 100+i) }
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < count; i++ {
+			conn.WriteMessage(websocket.BinaryMessage, pattern(i))
+		}
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	socket.ReuseReceiveBuffers = true
+	done := make(chan struct{})
+	i := 0
+	socket.OnBinaryMessage = func(data []byte, socket *Socket) {
+		if !bytes.Equal(data, pattern(i)) {
+			t.Errorf("message %d corrupted", i)
+		}
+		if i++; i == count {
+			close(done)
+		}
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("received %d of %d messages", i, count)
+	}
+}
+
+func BenchmarkReceiveReusedBuffers(b *testing.B) {
+	benchmarkReceive(b, func(socket *Socket, received func(int)) {
+		socket.ReuseReceiveBuffers = true
+		socket.OnBinaryMessage = func(data []byte, socket *Socket) { received(1) }
+	})
+}
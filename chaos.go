@@ -0,0 +1,84 @@
+package gowebsocket
+
+import (
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ChaosOptions injects faults into a socket for resilience testing. It only
+// takes effect in binaries built with the gowebsocket_chaos build tag; in
+// regular builds it is ignored, so it can never be switched on in production
+// by accident.
+type ChaosOptions struct {
+	DropRate   float64       // Probability of silently dropping a message, in either direction
+	Latency    time.Duration // Delay added before every message read or written
+	CloseRate  float64       // Probability, per message, of closing the connection
+	CloseCodes []int         // Close codes picked from at random; defaults to going away / try again later
+}
+
+var defaultChaosCloseCodes = []int{websocket.CloseGoingAway, websocket.CloseTryAgainLater}
+
+// withChaos wraps a newly dialed conn in a chaosConn if ChaosOptions apply.
+func (socket *Socket) withChaos(conn connection) connection {
+	if !chaosEnabled || socket.Chaos == nil {
+		return conn
+	}
+	return &chaosConn{connection: conn, options: socket.Chaos, log: socket.log}
+}
+
+// chaosConn injects the faults of ChaosOptions into the messages read from
+// and written to the connection it wraps. Control frames and messages
+// streamed through SendWriter pass through untouched.
+type chaosConn struct {
+	connection
+	options *ChaosOptions
+	log     *socketLogger
+}
+
+// NextReader returns the next message that is not dropped.
+func (conn *chaosConn) NextReader() (messageType int, r io.Reader, err error) {
+	for {
+		messageType, r, err = conn.connection.NextReader()
+		if err != nil || !conn.inject() {
+			return messageType, r, err
+		}
+	}
+}
+
+// WriteMessage writes data unless it is dropped.
+func (conn *chaosConn) WriteMessage(messageType int, data []byte) error {
+	if conn.inject() {
+		return nil
+	}
+	return conn.connection.WriteMessage(messageType, data)
+}
+
+// inject delays the current message and reports whether it should be
+// dropped, possibly closing the connection first.
+func (conn *chaosConn) inject() (drop bool) {
+	chaos := conn.options
+	if chaos.Latency > 0 {
+		time.Sleep(chaos.Latency)
+	}
+
+	if chaos.CloseRate > 0 && rand.Float64() < chaos.CloseRate {
+		codes := chaos.CloseCodes
+		if len(codes) == 0 {
+			codes = defaultChaosCloseCodes
+		}
+		code := codes[rand.Intn(len(codes))]
+		conn.log.warning("chaos: closing connection with code", code)
+		conn.connection.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, "chaos"), time.Now().Add(time.Second))
+		conn.connection.Close()
+		return true
+	}
+
+	if chaos.DropRate > 0 && rand.Float64() < chaos.DropRate {
+		conn.log.warning("chaos: dropping message")
+		return true
+	}
+	return false
+}
@@ -0,0 +1,6 @@
+//go:build !gowebsocket_chaos
+// +build !gowebsocket_chaos
+
+package gowebsocket
+
+const chaosEnabled = false
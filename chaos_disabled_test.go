@@ -0,0 +1,27 @@
+//go:build !gowebsocket_chaos
+// +build !gowebsocket_chaos
+
+package gowebsocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChaosIgnoredWithoutBuildTag(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.Chaos = &ChaosOptions{DropRate: 1}
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	socket.SendText("hello")
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message dropped without the gowebsocket_chaos build tag")
+	}
+}
@@ -0,0 +1,42 @@
+//go:build gowebsocket_chaos
+// +build gowebsocket_chaos
+
+package gowebsocket
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestChaosStillDelivers(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.Chaos = &ChaosOptions{DropRate: 0.3, CloseRate: 0.05, Latency: time.Millisecond}
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	received := make(chan string, 100)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	delivered := map[string]bool{}
+	deadline := time.After(10 * time.Second)
+	for i := 0; len(delivered) < 20; i++ {
+		socket.SendText(strconv.Itoa(i))
+		select {
+		case message := <-received:
+			delivered[message] = true
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("only %d messages delivered", len(delivered))
+		}
+	}
+	if socket.Stats().Reconnects == 0 {
+		t.Fatal("chaos never closed the connection")
+	}
+	if sent := socket.Stats().MessagesSent; sent <= uint64(len(delivered)) {
+		t.Fatalf("%d messages sent for %d delivered: none dropped", sent, len(delivered))
+	}
+}
@@ -0,0 +1,35 @@
+package gowebsocket
+
+import "io"
+
+// Client is the part of *Socket that applications typically depend on.
+// Holding a Client rather than a *Socket lets tests substitute a fake:
+//
+//	var client gowebsocket.Client = gowebsocket.NewClient(url)
+//
+// Handlers still receive the *Socket that called them; a fake may pass nil.
+type Client interface {
+	Connect() error
+	SendText(message string) error
+	SendBinary(data []byte) error
+	SendJSON(v interface{}) error
+	Close()
+	IsConnected() bool
+	State() ConnectionState
+	Done() <-chan struct{}
+	SetTextMessageHandler(handler func(message string, socket *Socket))
+	SetBinaryMessageHandler(handler func(data []byte, socket *Socket))
+	SetMessageHandler(handler func(messageType int, data []byte, socket *Socket))
+	SetMessageReaderHandler(handler func(messageType int, reader io.Reader, socket *Socket))
+	SetConnectedHandler(handler func(socket *Socket))
+	SetConnectErrorHandler(handler func(err error, socket *Socket))
+	SetDisconnectedHandler(handler func(err error, socket *Socket))
+}
+
+var _ Client = (*Socket)(nil)
+
+// NewClient is like New but returns the socket as a Client.
+func NewClient(url string) Client {
+	socket := New(url)
+	return &socket
+}
@@ -0,0 +1,165 @@
+package gowebsocket
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCloseFromMessageHandler(t *testing.T) {
+	closeCode := make(chan int, 1)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("bye"))
+		_, _, err := conn.ReadMessage()
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			closeCode <- closeErr.Code
+		}
+	})
+	socket := New(url)
+	closed := make(chan struct{})
+	socket.OnTextMessage = func(message string, socket *Socket) {
+		socket.Close()
+		close(closed)
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close called from OnTextMessage did not return")
+	}
+	waited := make(chan struct{})
+	go func() {
+		socket.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the receive loop did not exit")
+	}
+	if state := socket.State(); state != StateClosed {
+		t.Fatalf("state is %v, want StateClosed", state)
+	}
+	select {
+	case code := <-closeCode:
+		if code != websocket.CloseNormalClosure {
+			t.Fatalf("server got close code %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server got no close frame")
+	}
+}
+
+func TestFatalCloseCode(t *testing.T) {
+	var connections int32
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		atomic.AddInt32(&connections, 1)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4001, "banned"))
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	socket.FatalCloseCodes = []int{4001}
+	reconnecting := make(chan int, 1)
+	socket.OnReconnecting = func(attempt int, socket *Socket) { reconnecting <- attempt }
+	disconnected := make(chan error, 1)
+	socket.OnDisconnected = func(err error, socket *Socket) { disconnected <- err }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	select {
+	case err := <-disconnected:
+		var fatalErr *FatalCloseError
+		if !errors.As(err, &fatalErr) || fatalErr.Code != 4001 || fatalErr.Text != "banned" {
+			t.Fatalf("OnDisconnected got %v, want a *FatalCloseError with code 4001", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnDisconnected not called")
+	}
+	select {
+	case attempt := <-reconnecting:
+		t.Fatalf("reconnect attempt %d after a fatal close code", attempt)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if state := socket.State(); state != StateClosed {
+		t.Fatalf("state is %v, want StateClosed", state)
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Fatalf("server saw %d connections, want 1", n)
+	}
+}
+
+// hangingCloseConn is a mockConn whose Close blocks until release is
+// closed.
+type hangingCloseConn struct {
+	*mockConn
+	release chan struct{}
+}
+
+func (conn hangingCloseConn) Close() error {
+	<-conn.release
+	return conn.mockConn.Close()
+}
+
+func TestCloseWithTimeoutHangingClose(t *testing.T) {
+	conn := hangingCloseConn{newMockConn(), make(chan struct{})}
+	defer close(conn.release)
+	socket := New("ws://127.0.0.1:1")
+	useConn(&socket, conn)
+
+	start := time.Now()
+	err := socket.CloseWithTimeout(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("CloseWithTimeout returned after %v", elapsed)
+	}
+	if err != ErrCloseTimeout {
+		t.Fatalf("CloseWithTimeout = %v, want ErrCloseTimeout", err)
+	}
+	if socket.IsConnected() {
+		t.Fatal("still connected after CloseWithTimeout")
+	}
+	select {
+	case <-socket.Done():
+	default:
+		t.Fatal("Done not closed after CloseWithTimeout")
+	}
+}
+
+func TestCloseWithTimeoutInTime(t *testing.T) {
+	socket := New("ws://127.0.0.1:1")
+	useConn(&socket, newMockConn())
+	if err := socket.CloseWithTimeout(5 * time.Second); err != nil {
+		t.Fatalf("CloseWithTimeout = %v, want nil", err)
+	}
+}
+
+func TestCloseDisconnectsOnce(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	var attempts, disconnects int32
+	socket.OnReconnecting = func(attempt int, socket *Socket) { atomic.AddInt32(&attempts, 1) }
+	socket.OnDisconnected = func(err error, socket *Socket) { atomic.AddInt32(&disconnects, 1) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	socket.Close()
+	socket.Close()
+	socket.Wait()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&attempts); n != 0 {
+		t.Fatalf("%d reconnect attempts after Close", n)
+	}
+	if n := atomic.LoadInt32(&disconnects); n != 1 {
+		t.Fatalf("OnDisconnected called %d times, want 1", n)
+	}
+}
@@ -0,0 +1,58 @@
+package gowebsocket
+
+import (
+	"compress/flate"
+	"fmt"
+	"sync/atomic"
+)
+
+// Values of Socket.writeCompression.
+const (
+	writeCompressionDefault int32 = iota // Follow ConnectionOptions
+	writeCompressionOn
+	writeCompressionOff
+)
+
+// checkCompressionLevel rejects levels flate does not accept; zero stands for
+// gorilla's default.
+func checkCompressionLevel(level int) error {
+	if level != 0 && (level < flate.HuffmanOnly || level > flate.BestCompression) {
+		return fmt.Errorf("gowebsocket: invalid compression level %d: must be between %d and %d", level, flate.HuffmanOnly, flate.BestCompression)
+	}
+	return nil
+}
+
+// compressWrites reports whether messages are compressed unless a send says
+// otherwise.
+func (socket *Socket) compressWrites() bool {
+	switch atomic.LoadInt32(socket.writeCompression) {
+	case writeCompressionOn:
+		return true
+	case writeCompressionOff:
+		return false
+	}
+	return socket.ConnectionOptions.UseCompression || socket.ConnectionOptions.InitialWriteCompression
+}
+
+// SetWriteCompression turns compression of the following messages on or off,
+// overriding InitialWriteCompression, also after reconnects. It has no
+// effect unless compression was negotiated.
+func (socket *Socket) SetWriteCompression(enable bool) {
+	socket.sendMu.Lock()
+	defer socket.sendMu.Unlock()
+	value := writeCompressionOff
+	if enable {
+		value = writeCompressionOn
+	}
+	atomic.StoreInt32(socket.writeCompression, value)
+	if conn := socket.conn(); conn != nil {
+		conn.EnableWriteCompression(enable)
+	}
+}
+
+// SendBinaryNoCompress sends data like SendBinary but without compression,
+// for payloads such as images or archives that would not shrink.
+func (socket *Socket) SendBinaryNoCompress(data []byte) error {
+	compress := false
+	return socket.SendWithOptions(data, SendOptions{Binary: true, Compress: &compress})
+}
@@ -0,0 +1,119 @@
+package gowebsocket
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// frameRecorder wraps the client's TCP connection and keeps the first byte
+// of every write after the handshake, which holds a frame's FIN, RSV1 and
+// opcode bits.
+type frameRecorder struct {
+	net.Conn
+	mu     sync.Mutex
+	starts []byte
+}
+
+func (conn *frameRecorder) Write(p []byte) (int, error) {
+	if !strings.HasPrefix(string(p), "GET ") {
+		conn.mu.Lock()
+		conn.starts = append(conn.starts, p[0])
+		conn.mu.Unlock()
+	}
+	return conn.Conn.Write(p)
+}
+
+func (conn *frameRecorder) compressed() []bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	var compressed []bool
+	for _, start := range conn.starts {
+		compressed = append(compressed, start&0x40 != 0)
+	}
+	return compressed
+}
+
+// connectCompressed connects socket to an echo server that accepts
+// permessage-deflate and returns the recorder of its frames.
+func connectCompressed(t *testing.T, socket *Socket) *frameRecorder {
+	t.Helper()
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		echo(conn)
+	}))
+	t.Cleanup(server.Close)
+	socket.Url = "ws" + strings.TrimPrefix(server.URL, "http")
+
+	recorder := &frameRecorder{}
+	var dialer net.Dialer
+	socket.ConnectionOptions.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		recorder.Conn = conn
+		return recorder, err
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { socket.Close() })
+	if extensions := socket.HandshakeResponse.Header.Get("Sec-Websocket-Extensions"); !strings.Contains(extensions, "permessage-deflate") {
+		t.Fatalf("compression not negotiated: %q", extensions)
+	}
+	return recorder
+}
+
+// sendEchoed sends message and waits for the server to echo it.
+func sendEchoed(t *testing.T, socket *Socket, message string) {
+	t.Helper()
+	received := make(chan string, 1)
+	socket.SetTextMessageHandler(func(message string, socket *Socket) { received <- message })
+	if err := socket.SendText(message); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if got != message {
+			t.Fatalf("echoed %q, want %q", got, message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no echo")
+	}
+}
+
+func TestNegotiateCompressionWithoutInitialWriteCompression(t *testing.T) {
+	socket := New("")
+	socket.ConnectionOptions.UseCompression = false
+	socket.ConnectionOptions.NegotiateCompression = true
+	recorder := connectCompressed(t, &socket)
+
+	message := strings.Repeat("compress me ", 100)
+	sendEchoed(t, &socket, message)
+	socket.SetWriteCompression(true)
+	sendEchoed(t, &socket, message)
+	if got := recorder.compressed(); len(got) != 2 || got[0] || !got[1] {
+		t.Fatalf("compressed frames = %v, want [false true]", got)
+	}
+}
+
+func TestUseCompressionCompressesFromTheStart(t *testing.T) {
+	socket := New("")
+	socket.ConnectionOptions.UseCompression = true
+	recorder := connectCompressed(t, &socket)
+
+	sendEchoed(t, &socket, strings.Repeat("compress me ", 100))
+	if got := recorder.compressed(); len(got) != 1 || !got[0] {
+		t.Fatalf("compressed frames = %v, want [true]", got)
+	}
+}
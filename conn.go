@@ -0,0 +1,35 @@
+package gowebsocket
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connection is the subset of *websocket.Conn that Socket relies on. The
+// gorilla connection returned by the dialer satisfies it directly; tests and
+// alternative implementations can assign their own to Socket.Conn.
+type connection interface {
+	NextReader() (messageType int, r io.Reader, err error)
+	WriteMessage(messageType int, data []byte) error
+	NextWriter(messageType int) (io.WriteCloser, error)
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	PingHandler() func(appData string) error
+	SetPingHandler(h func(appData string) error)
+	PongHandler() func(appData string) error
+	SetPongHandler(h func(appData string) error)
+	CloseHandler() func(code int, text string) error
+	SetCloseHandler(h func(code int, text string) error)
+	EnableWriteCompression(enable bool)
+	SetCompressionLevel(level int) error
+	Subprotocol() string
+	UnderlyingConn() net.Conn
+	Close() error
+}
+
+var _ connection = (*websocket.Conn)(nil)
@@ -0,0 +1,252 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFailedReconnectKeepsConnUntilGivingUp(t *testing.T) {
+	server, url := startServer(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = 10 * time.Millisecond
+	socket.ReconnectionOptions.Times = 2
+	socket.OnDisconnected = func(err error, socket *Socket) {
+		server.Listener.Close()
+	}
+	kept := make(chan bool, 2)
+	socket.OnReconnecting = func(attempt int, socket *Socket) {
+		kept <- socket.conn() != nil
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	socket.SendText("bye")
+
+	for i := 0; i < 2; i++ {
+		if !<-kept {
+			t.Fatal("connection dropped while reconnect attempts were running")
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for socket.SendText("hello") != ErrNotConnected {
+		if time.Now().After(deadline) {
+			t.Fatal("sends do not fail with ErrNotConnected after reconnecting gave up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type mockMessage struct {
+	messageType int
+	data        []byte
+}
+
+// mockConn is a connection driven by the test: NextReader returns what is
+// pushed to inbound and io.EOF once it is closed, and writes are recorded.
+type mockConn struct {
+	inbound   chan mockMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	written   []mockMessage
+	control   []mockMessage
+	writeErr  error
+	ping      func(appData string) error
+	pong      func(appData string) error
+	close     func(code int, text string) error
+}
+
+func newMockConn() *mockConn {
+	return &mockConn{
+		inbound: make(chan mockMessage, 10),
+		closed:  make(chan struct{}),
+		ping:    func(string) error { return nil },
+		pong:    func(string) error { return nil },
+		close:   func(int, string) error { return nil },
+	}
+}
+
+func (conn *mockConn) NextReader() (int, io.Reader, error) {
+	select {
+	case message, ok := <-conn.inbound:
+		if !ok {
+			return 0, nil, io.EOF
+		}
+		return message.messageType, bytes.NewReader(message.data), nil
+	case <-conn.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (conn *mockConn) WriteMessage(messageType int, data []byte) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.isClosed() {
+		return net.ErrClosed
+	}
+	if conn.writeErr != nil {
+		return conn.writeErr
+	}
+	conn.written = append(conn.written, mockMessage{messageType, append([]byte(nil), data...)})
+	return nil
+}
+
+func (conn *mockConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	return &mockWriter{conn: conn, messageType: messageType}, nil
+}
+
+func (conn *mockConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	conn.mu.Lock()
+	conn.control = append(conn.control, mockMessage{messageType, append([]byte(nil), data...)})
+	conn.mu.Unlock()
+	return nil
+}
+
+func (conn *mockConn) Close() error {
+	conn.closeOnce.Do(func() { close(conn.closed) })
+	return nil
+}
+
+func (conn *mockConn) isClosed() bool {
+	select {
+	case <-conn.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (conn *mockConn) writes() []mockMessage {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return append([]mockMessage(nil), conn.written...)
+}
+
+func (conn *mockConn) SetReadLimit(int64)                                  {}
+func (conn *mockConn) SetReadDeadline(time.Time) error                     { return nil }
+func (conn *mockConn) SetWriteDeadline(time.Time) error                    { return nil }
+func (conn *mockConn) PingHandler() func(appData string) error             { return conn.ping }
+func (conn *mockConn) SetPingHandler(h func(appData string) error)         { conn.ping = h }
+func (conn *mockConn) PongHandler() func(appData string) error             { return conn.pong }
+func (conn *mockConn) SetPongHandler(h func(appData string) error)         { conn.pong = h }
+func (conn *mockConn) CloseHandler() func(code int, text string) error     { return conn.close }
+func (conn *mockConn) SetCloseHandler(h func(code int, text string) error) { conn.close = h }
+func (conn *mockConn) EnableWriteCompression(bool)                         {}
+func (conn *mockConn) SetCompressionLevel(int) error                       { return nil }
+func (conn *mockConn) Subprotocol() string                                 { return "" }
+func (conn *mockConn) UnderlyingConn() net.Conn                            { return nil }
+
+type mockWriter struct {
+	conn        *mockConn
+	messageType int
+	buffer      bytes.Buffer
+}
+
+func (writer *mockWriter) Write(p []byte) (int, error) { return writer.buffer.Write(p) }
+func (writer *mockWriter) Close() error {
+	return writer.conn.WriteMessage(writer.messageType, writer.buffer.Bytes())
+}
+
+// useConn makes socket use conn as if Connect had just dialed it.
+func useConn(socket *Socket, conn connection) {
+	socket.Conn = conn
+	atomic.StoreInt32(socket.live, 1)
+	socket.setState(StateConnected)
+	socket.start(nil)
+}
+
+func TestMockConnReadAndWrite(t *testing.T) {
+	conn := newMockConn()
+	socket := New("ws://127.0.0.1:1")
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	conn.inbound <- mockMessage{websocket.TextMessage, []byte("hello")}
+	if got := <-received; got != "hello" {
+		t.Fatalf("received %q, want %q", got, "hello")
+	}
+	if err := socket.SendText("reply"); err != nil {
+		t.Fatal(err)
+	}
+	writes := conn.writes()
+	if len(writes) != 1 || writes[0].messageType != websocket.TextMessage || string(writes[0].data) != "reply" {
+		t.Fatalf("written %v", writes)
+	}
+}
+
+func TestMockConnWriteRejected(t *testing.T) {
+	conn := newMockConn()
+	rejected := errors.New("rejected")
+	conn.writeErr = rejected
+	socket := New("ws://127.0.0.1:1")
+	var failed []byte
+	socket.OnSendFailed = func(messageType int, data []byte, err error, socket *Socket) { failed = data }
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	if err := socket.SendText("too big"); err != rejected {
+		t.Fatalf("SendText = %v, want the write error", err)
+	}
+	if string(failed) != "too big" {
+		t.Fatalf("OnSendFailed got %q", failed)
+	}
+	if !socket.IsConnected() || conn.isClosed() || socket.Stats().Disconnects[DisconnectWriteFailure] != 0 {
+		t.Fatal("a rejected message broke the connection")
+	}
+}
+
+func TestMockConnEOF(t *testing.T) {
+	conn := newMockConn()
+	socket := New("ws://127.0.0.1:1")
+	socket.ReconnectionOptions.Times = -1
+	disconnected := make(chan error, 1)
+	socket.OnDisconnected = func(err error, socket *Socket) { disconnected <- err }
+	useConn(&socket, conn)
+
+	close(conn.inbound)
+	if err := <-disconnected; err != io.EOF {
+		t.Fatalf("OnDisconnected got %v, want io.EOF", err)
+	}
+	socket.Wait()
+	if state := socket.State(); state != StateClosed {
+		t.Fatalf("state is %v, want StateClosed", state)
+	}
+	if !conn.isClosed() {
+		t.Fatal("connection left open")
+	}
+}
+
+func TestMockConnClose(t *testing.T) {
+	conn := newMockConn()
+	socket := New("ws://127.0.0.1:1")
+	useConn(&socket, conn)
+
+	socket.Close()
+	socket.Wait()
+	conn.mu.Lock()
+	control := conn.control
+	conn.mu.Unlock()
+	want := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if len(control) != 1 || control[0].messageType != websocket.CloseMessage || !bytes.Equal(control[0].data, want) {
+		t.Fatalf("control frames written: %v", control)
+	}
+	if !conn.isClosed() {
+		t.Fatal("connection left open")
+	}
+	if err := socket.SendText("late"); err == nil {
+		t.Fatal("SendText after Close succeeded")
+	}
+}
@@ -0,0 +1,148 @@
+package gowebsocket
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestConcurrentConnect starts many Connect calls at once. Run it with -race.
+func TestConcurrentConnect(t *testing.T) {
+	var connections int32
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		atomic.AddInt32(&connections, 1)
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	defer socket.Close()
+
+	const callers = 50
+	errs := make(chan error, callers)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- socket.Connect()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			succeeded++
+		case ErrAlreadyConnecting, ErrAlreadyConnected:
+		default:
+			t.Errorf("Connect failed with %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d Connect calls succeeded, want 1", succeeded)
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestConnectAfterClose(t *testing.T) {
+	var connections int32
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		atomic.AddInt32(&connections, 1)
+		echo(conn)
+	})
+	socket := New(url)
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	socket.Close()
+	active := ActiveSockets()
+
+	if err := socket.Connect(); err != ErrClosed {
+		t.Errorf("Connect after Close returned %v, want ErrClosed", err)
+	}
+	if err := socket.ConnectSync(); err != ErrClosed {
+		t.Errorf("ConnectSync after Close returned %v, want ErrClosed", err)
+	}
+	if state := socket.State(); state != StateClosed {
+		t.Errorf("state is %v, want StateClosed", state)
+	}
+	if n := ActiveSockets(); n != active {
+		t.Errorf("ActiveSockets went from %d to %d", active, n)
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+}
+
+// TestConnectSyncThenSend sends straight after ConnectSync returns. Run it
+// with -race.
+func TestConnectSyncThenSend(t *testing.T) {
+	_, url := startServer(t, echo)
+	for i := 0; i < 20; i++ {
+		socket := New(url)
+		received := make(chan string, 1)
+		socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+		if err := socket.ConnectSync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := socket.SendText("hello"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("echo not received")
+		}
+		socket.Close()
+	}
+}
+
+func TestConnectTimeoutBlackHole(t *testing.T) {
+	// A listener that is never accepted from: the TCP connection is made
+	// but the opening handshake is never answered.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	for _, test := range []struct {
+		name string
+		dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	}{
+		{"handshake unanswered", nil},
+		// Like a host that drops the SYN: the dial hangs until given up.
+		{"dial unanswered", func(ctx context.Context, network, addr string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}},
+	} {
+		socket := New("ws://" + listener.Addr().String())
+		socket.Timeout = 100 * time.Millisecond
+		socket.ConnectionOptions.NetDialContext = test.dial
+		start := time.Now()
+		err := socket.Connect()
+		elapsed := time.Since(start)
+		if err == nil {
+			socket.Close()
+			t.Fatalf("%s: connected", test.name)
+		}
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			t.Fatalf("%s: Connect = %v, want a timeout", test.name, err)
+		}
+		if elapsed > time.Second {
+			t.Fatalf("%s: Connect returned after %v with a Timeout of %v", test.name, elapsed, socket.Timeout)
+		}
+	}
+}
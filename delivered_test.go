@@ -0,0 +1,48 @@
+package gowebsocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestOnDeliveredUpToDrop(t *testing.T) {
+	conn := newMockConn()
+	socket := New("ws://127.0.0.1:1")
+	socket.ManualReconnect = true
+	var mu sync.Mutex
+	var delivered []uint64
+	socket.OnDelivered = func(id uint64, socket *Socket) {
+		mu.Lock()
+		delivered = append(delivered, id)
+		mu.Unlock()
+	}
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	for i := 1; i <= 5; i++ {
+		if i == 4 {
+			// The connection drops mid-stream.
+			conn.Close()
+		}
+		err := socket.SendText(fmt.Sprint("message ", i))
+		if (err == nil) != (i < 4) {
+			t.Fatalf("send %d returned %v", i, err)
+		}
+	}
+
+	writes := conn.writes()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delivered) != len(writes) {
+		t.Fatalf("%d messages delivered, %d written", len(delivered), len(writes))
+	}
+	for i, id := range delivered {
+		if id != uint64(i+1) || string(writes[i].data) != fmt.Sprint("message ", id) {
+			t.Fatalf("delivered ID %d for %q", id, writes[i].data)
+		}
+	}
+	if id := socket.LastSentID(); id != 3 {
+		t.Fatalf("LastSentID = %d, want 3", id)
+	}
+}
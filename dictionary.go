@@ -0,0 +1,52 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+)
+
+// DictionaryCodec deflates payloads against a preset dictionary, which helps
+// small messages that share common prefixes or field names.
+//
+// gorilla/websocket's permessage-deflate implementation creates its
+// compressors internally and offers no way to preload a dictionary, so this
+// cannot be applied to the connection's own compression. Instead use it at
+// the application layer: send the output of Encode with SendBinary and pass
+// received data to Decode in OnBinaryMessage. Both peers must use the same
+// dictionary.
+type DictionaryCodec struct {
+	dictionary []byte
+	level      int
+}
+
+// NewDictionaryCodec returns a codec that compresses with
+// flate.BestCompression against dictionary. Put the most common substrings
+// at the end of the dictionary, where they are cheapest to reference.
+func NewDictionaryCodec(dictionary []byte) *DictionaryCodec {
+	return &DictionaryCodec{dictionary: dictionary, level: flate.BestCompression}
+}
+
+// Encode returns data deflated against the codec's dictionary.
+func (codec *DictionaryCodec) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriterDict(&buf, codec.level, codec.dictionary)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode inflates data produced by Encode with the same dictionary. It fails
+// if data is not valid deflate output.
+func (codec *DictionaryCodec) Decode(data []byte) ([]byte, error) {
+	reader := flate.NewReaderDict(bytes.NewReader(data), codec.dictionary)
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
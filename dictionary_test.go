@@ -0,0 +1,37 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"testing"
+)
+
+func TestDictionaryCodec(t *testing.T) {
+	dictionary := []byte(`{"type":"trade","symbol":"","price":,"quantity":}`)
+	message := []byte(`{"type":"trade","symbol":"BTC-USD","price":64000.5,"quantity":2}`)
+	codec := NewDictionaryCodec(dictionary)
+	encoded, err := codec.Encode(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, message) {
+		t.Fatalf("round trip gave %q", decoded)
+	}
+
+	var plain bytes.Buffer
+	writer, _ := flate.NewWriter(&plain, flate.BestCompression)
+	writer.Write(message)
+	writer.Close()
+	if len(encoded) >= plain.Len() {
+		t.Fatalf("%d bytes with the dictionary, %d without", len(encoded), plain.Len())
+	}
+
+	decoded, err = NewDictionaryCodec([]byte("other")).Decode(encoded)
+	if err == nil && bytes.Equal(decoded, message) {
+		t.Fatal("decoded with the wrong dictionary")
+	}
+}
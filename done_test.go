@@ -0,0 +1,35 @@
+package gowebsocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDoneClosesOnCloseOnly(t *testing.T) {
+	_, url := startServer(t, dropFirst())
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	reconnected := make(chan struct{})
+	socket.OnReconnected = func(socket *Socket) { close(reconnected) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not reconnect")
+	}
+	select {
+	case <-socket.Done():
+		t.Fatal("Done closed by a transient disconnect")
+	default:
+	}
+
+	socket.Close()
+	select {
+	case <-socket.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done not closed by Close")
+	}
+}
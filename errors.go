@@ -0,0 +1,202 @@
+package gowebsocket
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrorKind classifies a read or write failure so applications can decide
+// whether reconnecting is worthwhile.
+type ErrorKind int
+
+const (
+	ErrorPermanent ErrorKind = iota
+	ErrorTimeout
+	ErrorTemporary
+)
+
+func (kind ErrorKind) String() string {
+	switch kind {
+	case ErrorTimeout:
+		return "timeout"
+	case ErrorTemporary:
+		return "temporary"
+	default:
+		return "permanent"
+	}
+}
+
+// ConnError is passed to OnError when reading from or writing to the
+// connection fails. It unwraps to the underlying error.
+type ConnError struct {
+	Op   string // "read" or "write"
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *ConnError) Error() string {
+	return "gowebsocket: " + e.Op + " (" + e.Kind.String() + "): " + e.Err.Error()
+}
+
+func (e *ConnError) Unwrap() error { return e.Err }
+
+func (e *ConnError) Timeout() bool { return e.Kind == ErrorTimeout }
+
+func (e *ConnError) Temporary() bool { return e.Kind == ErrorTemporary }
+
+// ReconnectError is passed to OnConnectError when an attempt made by
+// Reconnect fails, telling it apart from a failed initial connect. Attempt
+// counts from 1 within the Reconnect. It unwraps to the dial error.
+type ReconnectError struct {
+	Attempt int
+	Err     error
+}
+
+func (e *ReconnectError) Error() string {
+	return "gowebsocket: reconnect attempt " + strconv.Itoa(e.Attempt) + ": " + e.Err.Error()
+}
+
+func (e *ReconnectError) Unwrap() error { return e.Err }
+
+// SendBatchError is returned by SendTextBatch when a message could not be
+// sent. The first Sent messages were written or queued; the others were not.
+type SendBatchError struct {
+	Sent int
+	Err  error
+}
+
+func (e *SendBatchError) Error() string {
+	return "gowebsocket: batch stopped after " + strconv.Itoa(e.Sent) + " messages: " + e.Err.Error()
+}
+
+func (e *SendBatchError) Unwrap() error { return e.Err }
+
+// CallbackPanicError is reported to OnError when a callback run by the
+// receive loop panicked. Value is what was passed to panic and Stack the
+// goroutine's stack at that point.
+type CallbackPanicError struct {
+	Callback string
+	Value    interface{}
+	Stack    []byte
+}
+
+func (e *CallbackPanicError) Error() string {
+	return fmt.Sprintf("gowebsocket: %s panicked: %v", e.Callback, e.Value)
+}
+
+// CloseError is passed to OnDisconnected when the server closed the
+// connection with a close frame, carrying its code, e.g.
+// websocket.CloseGoingAway, and reason. Connections lost without a close
+// frame report the read or write error instead.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return "gowebsocket: closed by server with code " + strconv.Itoa(e.Code) + ": " + e.Text
+}
+
+// FatalCloseError is passed to OnDisconnected when the server closed the
+// connection with one of the socket's FatalCloseCodes.
+type FatalCloseError struct {
+	Code int
+	Text string
+}
+
+func (e *FatalCloseError) Error() string {
+	return "gowebsocket: fatal close " + strconv.Itoa(e.Code) + ": " + e.Text
+}
+
+// ProtocolError is reported in StrictMode when the peer violates the
+// WebSocket protocol. Code is the close code sent in response.
+type ProtocolError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return "gowebsocket: protocol violation: " + e.Reason
+}
+
+func newConnError(op string, err error) *ConnError {
+	return &ConnError{Op: op, Kind: classifyError(err), Err: err}
+}
+
+// classifyDisconnect picks the DisconnectCategory for an error passed to
+// OnDisconnected. Write failures are classified by the caller.
+func classifyDisconnect(err error) DisconnectCategory {
+	if err == nil {
+		return DisconnectNormal
+	}
+	var protocolErr *ProtocolError
+	if errors.As(err, &protocolErr) {
+		return DisconnectProtocolError
+	}
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeCategory(closeErr.Code)
+	}
+	var serverCloseErr *CloseError
+	if errors.As(err, &serverCloseErr) {
+		return closeCategory(serverCloseErr.Code)
+	}
+	var fatalErr *FatalCloseError
+	if errors.As(err, &fatalErr) {
+		return closeCategory(fatalErr.Code)
+	}
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return DisconnectProtocolError
+	}
+	if classifyError(err) == ErrorTimeout {
+		return DisconnectTimeout
+	}
+	return DisconnectOther
+}
+
+func closeCategory(code int) DisconnectCategory {
+	switch code {
+	case websocket.CloseNormalClosure:
+		return DisconnectNormal
+	case websocket.CloseGoingAway:
+		return DisconnectGoingAway
+	case websocket.CloseAbnormalClosure:
+		return DisconnectAbnormal
+	case websocket.CloseProtocolError, websocket.CloseUnsupportedData, websocket.CloseInvalidFramePayloadData:
+		return DisconnectProtocolError
+	}
+	return DisconnectOther
+}
+
+// isConnectionError reports whether a write failed because the connection
+// is broken, as opposed to the message being rejected.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	var closeErr *websocket.CloseError
+	return errors.As(err, &netErr) ||
+		errors.As(err, &closeErr) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+func classifyError(err error) ErrorKind {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		if netErr.Temporary() {
+			return ErrorTemporary
+		}
+	}
+	return ErrorPermanent
+}
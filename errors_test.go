@@ -0,0 +1,81 @@
+package gowebsocket
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type netError struct{ timeout, temporary bool }
+
+func (e netError) Error() string   { return "net error" }
+func (e netError) Timeout() bool   { return e.timeout }
+func (e netError) Temporary() bool { return e.temporary }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorKind
+	}{
+		{netError{timeout: true}, ErrorTimeout},
+		{netError{temporary: true}, ErrorTemporary},
+		{netError{}, ErrorPermanent},
+		{&net.OpError{Op: "read", Err: netError{timeout: true}}, ErrorTimeout},
+		{errors.New("boom"), ErrorPermanent},
+	}
+	for _, test := range tests {
+		if got := classifyError(test.err); got != test.want {
+			t.Errorf("classifyError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+// readError connects to a server running handle and returns the first
+// error passed to OnError.
+func readError(t *testing.T, handle func(conn *websocket.Conn)) *ConnError {
+	t.Helper()
+	_, url := startServer(t, handle)
+	socket := New(url)
+	socket.ReconnectionOptions.Times = -1
+	socket.Timeout = 50 * time.Millisecond
+	reported := make(chan error, 10)
+	socket.OnError = func(err error, socket *Socket) { reported <- err }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case err := <-reported:
+		var connErr *ConnError
+		if !errors.As(err, &connErr) {
+			t.Fatalf("OnError got %T %v, want a *ConnError", err, err)
+		}
+		return connErr
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error reported")
+		return nil
+	}
+}
+
+func TestReadTimeoutClassified(t *testing.T) {
+	err := readError(t, func(conn *websocket.Conn) {
+		time.Sleep(time.Second)
+	})
+	if err.Op != "read" || err.Kind != ErrorTimeout || !err.Timeout() {
+		t.Fatalf("got %v, want a read timeout", err)
+	}
+}
+
+func TestConnectionResetClassified(t *testing.T) {
+	err := readError(t, func(conn *websocket.Conn) {
+		// Close with a zero linger so that the client sees a reset.
+		conn.UnderlyingConn().(*net.TCPConn).SetLinger(0)
+	})
+	if err.Op != "read" || err.Kind != ErrorPermanent || !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("got %v, want a permanent connection reset", err)
+	}
+}
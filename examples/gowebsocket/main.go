@@ -25,19 +25,19 @@ func main() {
 	socket.RequestHeader.Set("Pragma", "no-cache")
 	socket.RequestHeader.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/49.0.2623.87 Safari/537.36")
 
-	socket.OnConnectError = func(err error, socket gowebsocket.Socket) {
+	socket.OnConnectError = func(err error, socket *gowebsocket.Socket) {
 		log.Fatal("Recieved connect error ", err)
 	};
-	socket.OnConnected = func(socket gowebsocket.Socket) {
+	socket.OnConnected = func(socket *gowebsocket.Socket) {
 		log.Println("Connected to server");
 	};
-	socket.OnTextMessage = func(message string, socket gowebsocket.Socket) {
+	socket.OnTextMessage = func(message string, socket *gowebsocket.Socket) {
 		log.Println("Recieved message  " + message)
 	};
-	socket.OnPingReceived = func(data string, socket gowebsocket.Socket) {
+	socket.OnPingReceived = func(data string, socket *gowebsocket.Socket) {
 		log.Println("Recieved ping " + data)
 	};
-	socket.OnDisconnected = func(err error, socket gowebsocket.Socket) {
+	socket.OnDisconnected = func(err error, socket *gowebsocket.Socket) {
 		log.Println("Disconnected from server ")
 		return
 	};
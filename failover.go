@@ -0,0 +1,162 @@
+package gowebsocket
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// urlFailover remembers which of the candidate URLs the socket last
+// connected to.
+type urlFailover struct {
+	mu      sync.Mutex
+	index   int
+	current string
+}
+
+// candidateURLs returns the URLs to dial in order of preference.
+func (socket *Socket) candidateURLs() []string {
+	if len(socket.Urls) > 0 {
+		return socket.Urls
+	}
+	return []string{socket.Url}
+}
+
+// firstCandidate returns the index in urls to start dialing from: the first
+// URL, or with RoundRobinUrls the one after the URL last connected to.
+func (socket *Socket) firstCandidate(urls []string) int {
+	if !socket.RoundRobinUrls {
+		return 0
+	}
+	socket.failover.mu.Lock()
+	defer socket.failover.mu.Unlock()
+	if socket.failover.current == "" {
+		return 0
+	}
+	return (socket.failover.index + 1) % len(urls)
+}
+
+func (socket *Socket) useURL(index int, url string) {
+	socket.failover.mu.Lock()
+	socket.failover.index = index
+	socket.failover.current = url
+	socket.failover.mu.Unlock()
+}
+
+// CurrentURL returns the URL of the current or, once disconnected, the most
+// recent connection. Before the first connect it returns the first
+// candidate.
+func (socket *Socket) CurrentURL() string {
+	socket.failover.mu.Lock()
+	defer socket.failover.mu.Unlock()
+	if socket.failover.current == "" {
+		return socket.candidateURLs()[0]
+	}
+	return socket.failover.current
+}
+
+// dialCandidates dials the candidate URLs in turn until one succeeds, the
+// context is done or all of them have failed, recording each dial in the
+// attempt history.
+func (socket *Socket) dialCandidates(ctx context.Context, attempt int) (conn *websocket.Conn, resp *http.Response, err error) {
+	urls := socket.candidateURLs()
+	first := socket.firstCandidate(urls)
+	for i := range urls {
+		index := (first + i) % len(urls)
+		conn, resp, err = socket.dial(ctx, urls[index], attempt)
+		if err == nil {
+			socket.useURL(index, urls[index])
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if i+1 < len(urls) {
+			socket.log.warning("Connecting to", urls[index], "failed, trying", urls[(index+1)%len(urls)])
+		}
+	}
+	return
+}
+
+// dial makes a single connection attempt to url.
+func (socket *Socket) dial(ctx context.Context, url string, attempt int) (conn *websocket.Conn, resp *http.Response, err error) {
+	timer := &dialTimer{}
+	start := time.Now()
+	if !socket.ConnectionOptions.UseSSL && strings.HasPrefix(strings.ToLower(url), "wss:") {
+		err = ErrTLSDisabled
+	} else {
+		conn, resp, err = dialAbortable(httptrace.WithClientTrace(ctx, timer.trace()), socket.WebsocketDialer, url, socket.RequestHeader)
+		if err != nil && socket.ConnectionOptions.AllowInsecureDowngrade && isNotTLS(err) {
+			plain := downgradeURL(url)
+			socket.log.warning("INSECURE: server does not speak TLS, retrying without encryption at", plain)
+			conn, resp, err = dialAbortable(httptrace.WithClientTrace(ctx, timer.trace()), socket.WebsocketDialer, plain, socket.RequestHeader)
+		}
+	}
+	record := AttemptRecord{Time: start, Duration: time.Since(start), Attempt: attempt, URL: url, Err: err}
+	timer.fill(&record)
+	socket.history.add(record)
+	return
+}
+
+// dialAbortable dials like dialer.DialContext but also gives up on the
+// opening handshake once ctx is done. gorilla only watches ctx while the
+// TCP connection is made, so a server that accepts but never answers the
+// upgrade would otherwise hold up Close until HandshakeTimeout, if any.
+func dialAbortable(ctx context.Context, dialer *websocket.Dialer, url string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	var (
+		mu       sync.Mutex
+		netConn  net.Conn
+		finished bool
+		aborted  bool
+	)
+	netDial := dialer.NetDialContext
+	if netDial == nil && dialer.NetDial != nil {
+		netDial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.NetDial(network, addr)
+		}
+	} else if netDial == nil {
+		netDial = (&net.Dialer{}).DialContext
+	}
+	abortable := *dialer
+	abortable.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := netDial(ctx, network, addr)
+		if err == nil {
+			mu.Lock()
+			netConn = conn
+			mu.Unlock()
+		}
+		return conn, err
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			if !finished && netConn != nil {
+				netConn.Close()
+				aborted = true
+			}
+			mu.Unlock()
+		case <-stop:
+		}
+	}()
+	conn, resp, err := abortable.DialContext(ctx, url, header)
+	close(stop)
+	mu.Lock()
+	finished = true
+	mu.Unlock()
+	if aborted {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, resp, ctx.Err()
+	}
+	return conn, resp, err
+}
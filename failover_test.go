@@ -0,0 +1,28 @@
+package gowebsocket
+
+import (
+	"testing"
+)
+
+func TestFailoverToSecondURL(t *testing.T) {
+	refusing, refusingURL := startServer(t, echo)
+	refusing.Close()
+	_, liveURL := startServer(t, echo)
+
+	socket := New("")
+	socket.Urls = []string{refusingURL, liveURL}
+	if got := socket.CurrentURL(); got != refusingURL {
+		t.Fatalf("CurrentURL before connecting = %q, want the first candidate", got)
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	if got := socket.CurrentURL(); got != liveURL {
+		t.Fatalf("CurrentURL = %q, want %q", got, liveURL)
+	}
+	history := socket.AttemptHistory()
+	if len(history) != 2 || history[0].URL != refusingURL || history[0].Err == nil || history[1].URL != liveURL || history[1].Err != nil {
+		t.Fatalf("attempts %+v, want a refused dial then a successful one", history)
+	}
+}
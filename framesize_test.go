@@ -0,0 +1,141 @@
+package gowebsocket
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMaxOutboundFrameSize(t *testing.T) {
+	received := make(chan string, 1)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		_, reader, err := conn.NextReader()
+		if err != nil {
+			return
+		}
+		data, _ := ioutil.ReadAll(reader)
+		received <- string(data)
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	socket.ConnectionOptions.MaxOutboundFrameSize = 100
+	recorder := &frameRecorder{}
+	var dialer net.Dialer
+	socket.ConnectionOptions.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		recorder.Conn = conn
+		return recorder, err
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	message := strings.Repeat("abcdefghij", 105)
+	if err := socket.SendText(message); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if got != message {
+			t.Fatalf("server reassembled %d bytes, want %d", len(got), len(message))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	recorder.mu.Lock()
+	starts := append([]byte(nil), recorder.starts...)
+	recorder.mu.Unlock()
+	if len(starts) < 11 {
+		t.Fatalf("message sent in %d frames, want at least 11", len(starts))
+	}
+	const fin = 0x80
+	if starts[0] != websocket.TextMessage {
+		t.Errorf("first frame starts with %#x, want a text frame without FIN", starts[0])
+	}
+	for _, start := range starts[1 : len(starts)-1] {
+		if start != 0 {
+			t.Errorf("middle frame starts with %#x, want a continuation frame without FIN", start)
+		}
+	}
+	if last := starts[len(starts)-1]; last != fin {
+		t.Errorf("last frame starts with %#x, want a continuation frame with FIN", last)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	var connections int32
+	closeCode := make(chan int, 1)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		if atomic.AddInt32(&connections, 1) > 1 {
+			echo(conn)
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 2000)))
+		_, _, err := conn.ReadMessage()
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			closeCode <- closeErr.Code
+		}
+	})
+	socket := New(url)
+	socket.MaxMessageSize = 1000
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	disconnected := make(chan error, 1)
+	socket.OnDisconnected = func(err error, socket *Socket) { disconnected <- err }
+	reconnected := make(chan struct{})
+	socket.OnReconnected = func(socket *Socket) { close(reconnected) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	select {
+	case code := <-closeCode:
+		if code != websocket.CloseMessageTooBig {
+			t.Fatalf("server got close code %d, want %d", code, websocket.CloseMessageTooBig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server got no close frame")
+	}
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, websocket.ErrReadLimit) {
+			t.Fatalf("OnDisconnected got %v, want websocket.ErrReadLimit", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnDisconnected not called")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not reconnect")
+	}
+	select {
+	case message := <-received:
+		t.Fatalf("oversized message delivered, %d bytes", len(message))
+	default:
+	}
+	if n := socket.Stats().Disconnects[DisconnectProtocolError]; n != 1 {
+		t.Fatalf("%d protocol error disconnects, want 1", n)
+	}
+
+	socket.SendText("small")
+	select {
+	case message := <-received:
+		if message != "small" {
+			t.Fatalf("received %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no echo on the new connection")
+	}
+}
@@ -0,0 +1,49 @@
+package gowebsocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestUnexpectedFrameType(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("text"))
+		conn.WriteMessage(websocket.BinaryMessage, []byte("binary"))
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	socket.ExpectedMessageType = websocket.BinaryMessage
+	unexpected := make(chan int, 2)
+	socket.OnUnexpectedFrameType = func(got int, socket *Socket) { unexpected <- got }
+	received := make(chan string, 2)
+	socket.OnBinaryMessage = func(data []byte, socket *Socket) { received <- string(data) }
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	select {
+	case got := <-unexpected:
+		if got != websocket.TextMessage {
+			t.Fatalf("OnUnexpectedFrameType got %d, want a text frame", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnUnexpectedFrameType not called")
+	}
+	// The binary frame follows the text one, so once it has arrived the
+	// text frame would have been dispatched too.
+	select {
+	case message := <-received:
+		if message != "binary" {
+			t.Fatalf("dispatched %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("binary frame not dispatched")
+	}
+	if len(unexpected) != 0 || len(received) != 0 {
+		t.Fatal("more frames reported than sent")
+	}
+}
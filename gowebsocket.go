@@ -1,14 +1,25 @@
 package gowebsocket
 
 import (
+	"bytes"
+	"context"
+	"crypto/cipher"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"reflect"
+	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 	"github.com/sacOO7/go-logger"
@@ -19,48 +30,373 @@ type Empty struct {
 
 var logger = logging.GetLogger(reflect.TypeOf(Empty{}).PkgPath()).SetLevel(logging.OFF)
 
-func (socket Socket) EnableLogging() {
+func (socket *Socket) EnableLogging() {
 	logger.SetLevel(logging.TRACE)
 }
 
-func (socket Socket) GetLogger() logging.Logger {
+func (socket *Socket) GetLogger() logging.Logger {
 	return logger
 }
 
 type Socket struct {
-	Conn                *websocket.Conn
-	WebsocketDialer     *websocket.Dialer
-	Url                 string
+	Conn            connection
+	WebsocketDialer *websocket.Dialer
+	Url             string
+	// Urls, when set, replaces Url with several endpoints, e.g. the nodes of
+	// a cluster. Each connect and reconnect attempt dials them in order
+	// until one succeeds; see CurrentURL for the one in use.
+	Urls []string
+	// RoundRobinUrls starts each connect with the URL after the one last
+	// connected to instead of the first, spreading reconnects across Urls.
+	RoundRobinUrls      bool
 	ConnectionOptions   ConnectionOptions
 	ReconnectionOptions ReconnectionOptions
 	RequestHeader       http.Header
-	OnConnected         func(socket Socket)
-	OnTextMessage       func(message string, socket Socket)
-	OnBinaryMessage     func(data []byte, socket Socket)
-	OnConnectError      func(err error, socket Socket)
-	OnDisconnected      func(err error, socket Socket)
-	OnPingReceived      func(data string, socket Socket)
-	OnPongReceived      func(data string, socket Socket)
-	IsConnected         bool
-	Timeout             time.Duration
-	sendMu              *sync.Mutex // Prevent "concurrent write to websocket connection"
-	receiveMu           *sync.Mutex
+	// HandshakeResponse is the server's response to the latest handshake,
+	// kept on success and on failure so its status and headers can be
+	// inspected; it is nil if no response was received. The dialer has
+	// already consumed the body and released the connection: on failure it
+	// holds up to the first 1024 bytes the server sent, on success it is
+	// empty.
+	HandshakeResponse *http.Response
+	// Logger receives the socket's log lines. It defaults to the package
+	// logger, which is silent until EnableLogging is called; setting a
+	// different one allows per-socket levels and routing into an
+	// application's own logging. Changes take effect on the next connect.
+	Logger Logger
+	// The callbacks receive the socket they are registered on, so they see
+	// its live state and may call its methods, such as SendText.
+	OnConnected     func(socket *Socket)
+	OnTextMessage   func(message string, socket *Socket)
+	OnBinaryMessage func(data []byte, socket *Socket)
+	// OnMessage is called for every data frame, whatever its type, before
+	// the typed callbacks OnTextMessage, OnJSONMessage and OnBinaryMessage,
+	// giving a single place for custom framing or instrumentation. Like
+	// them it is not called when Messages, OnBatch or OnMessageReader take
+	// over delivery. With ReuseReceiveBuffers data must not be retained.
+	OnMessage func(messageType int, data []byte, socket *Socket)
+	// OnJSONMessage is called with the payload of every text frame, after
+	// OnTextMessage, leaving decoding to the callback. The payload is not
+	// validated. With ReuseReceiveBuffers it must not be retained.
+	OnJSONMessage func(data json.RawMessage, socket *Socket)
+	// OnMessageReader, when set, replaces OnTextMessage and OnBinaryMessage
+	// and streams each data frame straight from the connection, avoiding the
+	// per-message allocation. The reader is only valid until the callback
+	// returns; any unread remainder is discarded before the next message.
+	OnMessageReader func(messageType int, reader io.Reader, socket *Socket)
+	// ReuseReceiveBuffers reads every frame into a buffer taken from a shared
+	// pool and returns it once the handlers have run. The data passed to
+	// OnBinaryMessage and the reader passed to OnMessageReader must not be
+	// retained past the callback.
+	ReuseReceiveBuffers bool
+	// ManualRecvStart makes Connect and ConnectSync return with the
+	// connection established and handlers bound, but without reading any
+	// messages until StartReceiving is called. Reconnects start receiving
+	// straight away.
+	ManualRecvStart bool
+	// ManualReconnect leaves replacing a lost connection to the application:
+	// the loss is reported to OnDisconnected and the socket stays
+	// disconnected until Reconnect or Connect is called. Sends meanwhile
+	// fail, or are queued if SendQueueSize is set. Unlike a negative
+	// ReconnectionOptions.Times, it does not close the socket for good.
+	ManualReconnect bool
+	// WarnOnMissingHandlers logs a warning and reports ErrNoHandler to
+	// OnError the first time a message is dropped because no handler for its
+	// type is set.
+	WarnOnMissingHandlers bool
+	// OnBatch, when set, replaces the other message callbacks. Frames are
+	// queued as they are read and handed over in order, as many at a time as
+	// have arrived since the previous call, up to maxBatchSize. Messages
+	// still queued when the socket closes are delivered all the same.
+	OnBatch func(messages []Message, socket *Socket)
+	// OnConnectError is called when a dial fails. For attempts made by
+	// Reconnect the error is a *ReconnectError carrying the attempt number.
+	OnConnectError func(err error, socket *Socket)
+	// OnReconnecting is called before each reconnect attempt, counting from
+	// 1, and OnReconnected once an attempt has succeeded and receiving has
+	// resumed. OnConnected fires for reconnects as well, before
+	// OnReconnected.
+	OnReconnecting func(attempt int, socket *Socket)
+	OnReconnected  func(socket *Socket)
+	// OnDisconnected is called once for each lost connection. A close frame
+	// from the server is reported as a *CloseError, or a *FatalCloseError
+	// for FatalCloseCodes.
+	OnDisconnected func(err error, socket *Socket)
+	// OnTrace, when set, receives an event with a timestamp for every state
+	// transition and frame sent or received, for building diagnostic
+	// timelines. It is called synchronously from the goroutine causing the
+	// event, so it must be quick.
+	OnTrace func(event TraceEvent)
+	// OnError is called for read and write failures with a *ConnError
+	// classifying them, before the disconnect is handled, and with a
+	// *CallbackPanicError when a message, ping or pong callback panicked;
+	// receiving then carries on with the next frame.
+	OnError func(err error, socket *Socket)
+	// OnSendFailed is called with the undelivered payload when a write fails
+	// and could not be completed after reconnecting either.
+	OnSendFailed func(messageType int, data []byte, err error, socket *Socket)
+	// OnCircuitOpen is called when ReconnectionOptions.CircuitBreaker pauses
+	// reconnection.
+	OnCircuitOpen func(socket *Socket)
+	// OnDelivered is called with a message's ID once it has been written.
+	OnDelivered func(id uint64, socket *Socket)
+	// ResendUnackedOnReconnect keeps every written message until the
+	// application acknowledges its ID via Ack and, after a successful
+	// reconnect, resends the unacknowledged ones in their original order.
+	ResendUnackedOnReconnect bool
+	// RetryRequestsOnReconnect sends the requests made with Request or
+	// StartRequest that are still waiting for their reply again once a lost
+	// connection is replaced, as the reply may have been lost with it. A
+	// second reply then goes to the message callbacks. Without it such
+	// requests fail with ErrRequestInterrupted when the connection is lost.
+	RetryRequestsOnReconnect bool
+	// AckWindow, when positive, limits how many written messages may wait
+	// for their Ack at once: the Send methods block until Ack frees a slot,
+	// or fail with ErrClosed if the socket is closed meanwhile.
+	// SendTextBatch waits before each message, keeping other sends out.
+	// SendWriter waits too, but its message takes no slot as it is not kept
+	// for Ack. Messages in the send queue are not held back; they count
+	// from when they are written.
+	AckWindow int
+	// OutboundInterceptors transform every message sent through the Send
+	// methods, in order, before it is written or queued; see
+	// OutboundInterceptor. SendWriter streams are not intercepted.
+	OutboundInterceptors []OutboundInterceptor
+	// SendQueueSize, when positive, queues up to this many messages sent
+	// while disconnected, including one whose write failed and could not be
+	// retried, and sends them in order once connected again. Sends beyond
+	// that fail with ErrSendQueueFull, and sends after Close with ErrClosed.
+	// Queued messages count as delivered when flushed.
+	SendQueueSize int
+	// SendQueueCipher, when set, encrypts messages while they wait in the
+	// send queue, so that their plaintext does not linger in memory. Each is
+	// sealed with a random nonce when queued and opened just before it is
+	// written; the plaintext is then cleared. It must not be changed while
+	// messages are queued.
+	SendQueueCipher cipher.AEAD
+	OnPingReceived  func(data string, socket *Socket)
+	OnPongReceived  func(data string, socket *Socket)
+	// OnPingReceivedBytes and OnPongReceivedBytes receive the raw control
+	// frame payload and are called after their string counterparts.
+	OnPingReceivedBytes func(data []byte, socket *Socket)
+	OnPongReceivedBytes func(data []byte, socket *Socket)
+	// OnSubprotocolMismatch is called when the Sec-WebSocket-Protocol response
+	// header disagrees with the subprotocol reported by the connection.
+	OnSubprotocolMismatch func(err error, socket *Socket)
+	// Timeout, when non-zero, bounds the wait for each inbound message, each
+	// write that has no deadline of its own, so a stalled connection cannot
+	// block senders indefinitely, and the opening handshake unless
+	// ConnectionOptions.HandshakeTimeout is set. Zero means no deadline.
+	// The read deadline is hard: pings and pongs arriving meanwhile do not
+	// extend it, so with KeepAlive on a quiet connection use IdleTimeout.
+	Timeout time.Duration
+	// IdleTimeout, when positive, drops the connection if no frame at all,
+	// pings and pongs included, arrives within this window, reconnecting as
+	// configured by ReconnectionOptions. Unlike Timeout, every frame restarts
+	// the window. Zero disables it.
+	IdleTimeout time.Duration
+	// KeepAlive, when positive, pings the server at this interval while
+	// connected. If a pong has not arrived by the time the next ping is due
+	// the connection is considered dead and is dropped, reconnecting as
+	// configured by ReconnectionOptions.
+	KeepAlive time.Duration
+	Chaos     *ChaosOptions
+	// FatalCloseCodes lists close codes after which the socket is closed for
+	// good instead of reconnecting; OnDisconnected then receives a
+	// *FatalCloseError.
+	FatalCloseCodes []int
+	// ExpectedMessageType restricts inbound data frames to TextMessage or
+	// BinaryMessage. Frames of the other type are not dispatched and are
+	// reported to OnUnexpectedFrameType instead. Zero accepts both.
+	ExpectedMessageType   int
+	OnUnexpectedFrameType func(got int, socket *Socket)
+	// MaxInboundRate limits inbound data frames to this many per second,
+	// allowing bursts of up to one second's worth. A peer exceeding it is
+	// disconnected for good with a policy violation close code, and OnError
+	// and OnDisconnected receive ErrInboundRateExceeded. Zero disables it.
+	MaxInboundRate float64
+	// MaxMessageSize caps the size of inbound messages in bytes. A larger
+	// message fails the read with websocket.ErrReadLimit, after a close frame
+	// with CloseMessageTooBig has been sent, and the connection is dropped
+	// like any other read error. Zero means no limit.
+	MaxMessageSize int64
+	// StrictMode closes the connection for good on protocol violations
+	// gorilla tolerates, currently invalid UTF-8 in a text frame, and reports
+	// a *ProtocolError to OnError and OnDisconnected. Frames streamed to
+	// OnMessageReader are not checked.
+	StrictMode       bool
+	sendMu           *sync.Mutex // Prevent "concurrent write to websocket connection"
+	receiveMu        *sync.Mutex
+	reconnectMu      *sync.Mutex   // Guards ReconnectionOptions against the reconnect loop
+	handlerMu        *sync.RWMutex // Guards message handlers swapped at runtime, and Conn
+	pongMu           *sync.Mutex   // Orders automatic pongs ahead of the close frame
+	active           *int32        // 1 while counted in activeSockets
+	reconnecting     *int32        // 1 while a Reconnect loop is running
+	recvPending      *int32        // 1 while ManualRecvStart waits for StartReceiving
+	writeStarted     *int64        // UnixNano when the write in progress began, 0 if none
+	writeCompression *int32        // writeCompressionDefault, On or Off, see SetWriteCompression
+	state            *int32        // ConnectionState
+	live             *int32        // 1 from connecting until the loss of the connection is reported
+	lastPong         *int64        // UnixNano of the latest pong received
+	readDeadline     *int64        // UnixNano of the Timeout deadline of the read in progress, 0 if none
+	warnedDropped    *int32        // 1 once WarnOnMissingHandlers has warned
+	log              *socketLogger
+	messageID        *uint64 // Last ID assigned to an outbound message
+	lastSentID       *uint64 // Last ID successfully written
+	stats            *socketStats
+	done             chan struct{}
+	doneOnce         *sync.Once
+	history          *attemptHistory
+	unacked          *unackedMessages
+	failover         *urlFailover
+	requests         *pendingRequests
+	queue            *sendQueue
+	messages         *messageChannel
+	breaker          *circuitBreakerState
+	ready            *readyBarrier
+	firstMessage     chan<- firstMessage // Set by ConnectAndAwaitFirst, guarded by handlerMu
+	reconnect        *reconnectLoop
+	running          *activity
+	inbound          *inboundRate
+	batch            chan Message
+	batchSizes       *bufferedSizes
+	batchOnce        *sync.Once
+	async            chan asyncSend
+	asyncOnce        *sync.Once
+	asyncMu          *sync.Mutex // Orders SendAsync against draining the queue on close
 }
 
 type ConnectionOptions struct {
+	// UseCompression negotiates permessage-deflate and compresses writes; it
+	// is shorthand for setting both NegotiateCompression and
+	// InitialWriteCompression.
 	UseCompression bool
-	UseSSL         bool
-	Proxy          func(*http.Request) (*url.URL, error)
-	Subprotocols   []string
+	// NegotiateCompression offers permessage-deflate during the handshake.
+	NegotiateCompression bool
+	// InitialWriteCompression controls whether writes are compressed right
+	// after connecting, when compression was negotiated.
+	InitialWriteCompression bool
+	// CompressionLevel sets the flate level used for compressed writes, from
+	// flate.HuffmanOnly (-2) to flate.BestCompression (9); connecting fails
+	// with other values. Zero keeps gorilla's default, flate.BestSpeed; to
+	// send uncompressed, turn write compression off instead.
+	CompressionLevel int
+	// UseSSL permits TLS: wss URLs are dialed over TLS when it is set and
+	// rejected with ErrTLSDisabled when it is not. ws URLs never use TLS.
+	UseSSL bool
+	// InsecureSkipVerify disables verification of the server's certificate
+	// chain and host name. Only meant for testing; it is ignored when
+	// TLSConfig or TLSConfigProvider is set.
+	InsecureSkipVerify bool
+	// AllowInsecureDowngrade retries a wss URL once as plain ws when the
+	// server answers the TLS handshake with something that is not TLS. The
+	// connection is then unencrypted; only meant for development servers.
+	AllowInsecureDowngrade bool
+	Proxy                  func(*http.Request) (*url.URL, error)
+	Subprotocols           []string
+	// TLSConfig, when set, is used as the dialer's TLS configuration as it
+	// is, for client certificates, custom root CAs, SNI or pinned cipher
+	// suites. It must not be modified after connecting.
+	TLSConfig *tls.Config
+	// TLSConfigProvider, when set, takes precedence over TLSConfig. It is
+	// called before every dial (including reconnects) and its result is used
+	// as the TLS configuration, so rotated CAs or client certificates are
+	// picked up without recreating the socket.
+	TLSConfigProvider func() *tls.Config
+	// LocalAddr pins outbound connections to a local address, e.g. a
+	// *net.TCPAddr with only the IP set, on multi-homed hosts. It is ignored
+	// when NetDialContext is set.
+	LocalAddr net.Addr
+	// NetDialContext, when set, opens the TCP connections, giving full
+	// control over the local address, TCP keepalive and dial timeout, e.g.
+	// through a net.Dialer's DialContext. Nil leaves gorilla's default.
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// MaxOutboundFrameSize splits larger messages into continuation frames
+	// of at most this many payload bytes. Client writes go through gorilla's
+	// NextWriter, which flushes a frame each time its write buffer fills, so
+	// this sets the dialer's WriteBufferSize. Zero keeps gorilla's default.
+	MaxOutboundFrameSize int
+	// HandshakeTimeout bounds the opening handshake, including the TCP and
+	// TLS setup. Zero falls back to the dialer's own setting or, if it has
+	// none, Socket.Timeout.
+	HandshakeTimeout time.Duration
+	// ReadBufferSize and WriteBufferSize set the dialer's I/O buffer sizes;
+	// zero leaves the dialer's setting. MaxOutboundFrameSize takes
+	// precedence over WriteBufferSize.
+	ReadBufferSize  int
+	WriteBufferSize int
+	// PoolWriteBuffers shares write buffers between connections through a
+	// pool, so a connection only holds one while a message is being
+	// written. It saves memory with many sockets that send now and then.
+	PoolWriteBuffers bool
 }
 
-// todo Yet to be done
+// ReconnectionOptions controls how a lost connection is re-established.
 type ReconnectionOptions struct {
+	// Times limits the attempts per reconnect: zero retries until connected,
+	// a negative value disables reconnection so the socket closes for good
+	// when the connection is lost.
 	Times    int
 	Interval time.Duration
+	// Multiplier grows the delay between attempts geometrically, from
+	// Interval up to MaxInterval. Zero or one keeps a fixed Interval.
+	Multiplier  float64
+	MaxInterval time.Duration // Zero leaves the delay uncapped
+	// Jitter randomizes each delay between half and all of its value, so
+	// that many clients dropped together do not retry in lockstep.
+	Jitter         bool
+	CircuitBreaker CircuitBreaker
+	// SuccessRateWindow is the rolling window for Stats().ReconnectSuccessRate,
+	// ten minutes if zero.
+	SuccessRateWindow time.Duration
+	// MaxElapsedTime, when positive, bounds the time a Reconnect spends
+	// waiting and dialing in total. Once it has passed, or the next wait
+	// would pass it, Reconnect gives up with ErrReconnectTimeout, which is
+	// also passed to OnDisconnected. Zero keeps retrying as Times allows.
+	MaxElapsedTime time.Duration
 }
 
-var reconnectFlag int32 = 0
+var ErrSubprotocolMismatch = errors.New("gowebsocket: subprotocol mismatch")
+
+var ErrClosed = errors.New("gowebsocket: socket closed")
+
+var ErrReconnectDisabled = errors.New("gowebsocket: reconnection disabled")
+
+var ErrReconnectTimeout = errors.New("gowebsocket: reconnection timed out")
+
+var ErrTLSDisabled = errors.New("gowebsocket: wss URL with ConnectionOptions.UseSSL unset")
+
+var ErrInboundRateExceeded = errors.New("gowebsocket: inbound message rate exceeded")
+
+var ErrCloseTimeout = errors.New("gowebsocket: close timed out")
+
+// ErrNoHandler is reported to OnError, with WarnOnMissingHandlers, when a
+// message is dropped because no handler for its type is set.
+var ErrNoHandler = errors.New("gowebsocket: no handler for message")
+
+// ErrNotConnected is returned by sends on a socket that has never connected
+// or whose reconnect attempts all failed.
+var ErrNotConnected = errors.New("gowebsocket: not connected")
+
+// ErrAlreadyConnecting and ErrAlreadyConnected are returned by the Connect
+// methods when another call is still dialing, or has already connected.
+var (
+	ErrAlreadyConnecting = errors.New("gowebsocket: already connecting")
+	ErrAlreadyConnected  = errors.New("gowebsocket: already connected")
+)
+
+// closeWriteWait bounds how long writing the close frame may block.
+const closeWriteWait = time.Second
+
+var activeSockets int32
+
+// ActiveSockets returns the number of sockets with a live receive goroutine:
+// those connected, or reconnecting after losing their connection. A socket
+// stops counting once it is closed, gives up reconnecting or, with
+// ManualReconnect, loses its connection.
+func ActiveSockets() int {
+	return int(atomic.LoadInt32(&activeSockets))
+}
 
 func New(url string) Socket {
 	return Socket{
@@ -75,58 +411,333 @@ func New(url string) Socket {
 		Timeout:             0,
 		sendMu:              &sync.Mutex{},
 		receiveMu:           &sync.Mutex{},
+		reconnectMu:         &sync.Mutex{},
+		pongMu:              &sync.Mutex{},
+		handlerMu:           &sync.RWMutex{},
+		active:              new(int32),
+		reconnecting:        new(int32),
+		recvPending:         new(int32),
+		writeStarted:        new(int64),
+		writeCompression:    new(int32),
+		state:               new(int32),
+		live:                new(int32),
+		lastPong:            new(int64),
+		readDeadline:        new(int64),
+		warnedDropped:       new(int32),
+		Logger:              packageLogger{},
+		log:                 &socketLogger{name: hostOf(url), logger: packageLogger{}},
+		messageID:           new(uint64),
+		lastSentID:          new(uint64),
+		stats:               &socketStats{},
+		done:                make(chan struct{}),
+		doneOnce:            &sync.Once{},
+		history:             &attemptHistory{},
+		unacked:             &unackedMessages{},
+		failover:            &urlFailover{},
+		requests:            &pendingRequests{},
+		queue:               &sendQueue{},
+		messages:            &messageChannel{},
+		breaker:             &circuitBreakerState{},
+		ready:               newReadyBarrier(),
+		batch:               make(chan Message, maxBatchSize),
+		batchSizes:          newBufferedSizes(maxBatchSize),
+		batchOnce:           &sync.Once{},
+		async:               make(chan asyncSend, asyncQueueSize),
+		asyncOnce:           &sync.Once{},
+		asyncMu:             &sync.Mutex{},
+		reconnect:           &reconnectLoop{},
+		running:             &activity{},
+		inbound:             &inboundRate{},
+	}
+}
+
+// NewValidated is like New but rejects URLs that are not ws or wss or that
+// have no host, instead of failing later at dial time.
+func NewValidated(rawURL string) (*Socket, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("gowebsocket: invalid url %q: %w", rawURL, err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("gowebsocket: invalid url %q: scheme must be ws or wss", rawURL)
 	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("gowebsocket: invalid url %q: missing host", rawURL)
+	}
+	socket := New(rawURL)
+	return &socket, nil
 }
 
+// setConnectionOptions applies ConnectionOptions to WebsocketDialer. Only
+// the options that are set are applied, so fields configured on the dialer
+// directly are left alone.
 func (socket *Socket) setConnectionOptions() {
-	socket.WebsocketDialer.EnableCompression = socket.ConnectionOptions.UseCompression
-	socket.WebsocketDialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: socket.ConnectionOptions.UseSSL}
-	socket.WebsocketDialer.Proxy = socket.ConnectionOptions.Proxy
-	socket.WebsocketDialer.Subprotocols = socket.ConnectionOptions.Subprotocols
+	dialer := socket.WebsocketDialer
+	options := socket.ConnectionOptions
+	if options.UseCompression || options.NegotiateCompression {
+		dialer.EnableCompression = true
+	}
+	if options.TLSConfigProvider != nil {
+		dialer.TLSClientConfig = options.TLSConfigProvider()
+	} else if options.TLSConfig != nil {
+		dialer.TLSClientConfig = options.TLSConfig
+	} else if options.InsecureSkipVerify {
+		config := &tls.Config{}
+		if dialer.TLSClientConfig != nil {
+			config = dialer.TLSClientConfig.Clone()
+		}
+		config.InsecureSkipVerify = true
+		dialer.TLSClientConfig = config
+	}
+	if options.Proxy != nil {
+		dialer.Proxy = options.Proxy
+	}
+	if options.Subprotocols != nil {
+		dialer.Subprotocols = options.Subprotocols
+	}
+	if options.HandshakeTimeout > 0 {
+		dialer.HandshakeTimeout = options.HandshakeTimeout
+	} else if socket.Timeout > 0 && dialer.HandshakeTimeout == 0 {
+		dialer.HandshakeTimeout = socket.Timeout
+	}
+	if options.ReadBufferSize > 0 {
+		dialer.ReadBufferSize = options.ReadBufferSize
+	}
+	if options.WriteBufferSize > 0 {
+		dialer.WriteBufferSize = options.WriteBufferSize
+	}
+	if options.MaxOutboundFrameSize > 0 {
+		dialer.WriteBufferSize = options.MaxOutboundFrameSize
+	}
+	if options.PoolWriteBuffers {
+		dialer.WriteBufferPool = writeBufferPool(dialer.WriteBufferSize)
+	}
+	if options.NetDialContext != nil {
+		dialer.NetDialContext = options.NetDialContext
+	} else if options.LocalAddr != nil {
+		netDialer := &net.Dialer{LocalAddr: options.LocalAddr}
+		dialer.NetDialContext = netDialer.DialContext
+	}
 }
 func (socket *Socket) DoConnect() (err error) {
-	var resp *http.Response
+	return socket.doConnect(context.Background(), 0)
+}
+
+// doConnect dials the server; attempt is 0 for the initial connect and the
+// retry count when called from Reconnect.
+func (socket *Socket) doConnect(ctx context.Context, attempt int) (err error) {
+	if err := checkCompressionLevel(socket.ConnectionOptions.CompressionLevel); err != nil {
+		return err
+	}
+	if attempt == 0 {
+		if err := socket.beginConnect(); err != nil {
+			return err
+		}
+	}
 	socket.setConnectionOptions()
+	socket.log.setLogger(socket.Logger)
+	socket.traceEvent(TraceEvent{Type: TraceConnecting, Attempt: attempt})
 
-	socket.Conn, resp, err = socket.WebsocketDialer.Dial(socket.Url, socket.RequestHeader)
+	conn, resp, err := socket.dialCandidates(ctx, attempt)
+	socket.handlerMu.Lock()
+	if err == nil {
+		// A failed dial keeps the previous connection, so a concurrent
+		// reader never finds Conn gone from under it.
+		socket.Conn = socket.withChaos(conn)
+	}
+	socket.HandshakeResponse = resp
+	socket.handlerMu.Unlock()
 
 	if err != nil {
-		logger.Error.Println("Error while connecting to server ", err)
+		socket.log.error("Error while connecting to server ", err)
 		if resp != nil {
-			logger.Error.Println("HTTP Response %d status: %s", resp.StatusCode, resp.Status)
+			socket.log.error("HTTP Response", resp.StatusCode, "status:", resp.Status)
+		}
+		if attempt == 0 {
+			socket.setState(StateDisconnected)
 		}
-		socket.IsConnected = false
-		if socket.OnConnectError != nil {
-			socket.OnConnectError(err, *socket)
+		if onConnectError := socket.snapshot().OnConnectError; onConnectError != nil {
+			reported := err
+			if attempt > 0 {
+				reported = &ReconnectError{Attempt: attempt, Err: err}
+			}
+			socket.reconnectCallback(attempt, func() { onConnectError(reported, socket) })
 		}
 		return err
 	}
 
-	logger.Info.Println("Connected to server")
-	socket.IsConnected = true
-	if socket.OnConnected != nil {
-		socket.OnConnected(*socket)
+	socket.log.info("Connected to server")
+	socket.traceEvent(TraceEvent{Type: TraceConnected, Attempt: attempt})
+	socket.stats.connected(time.Now())
+	atomic.StoreInt32(socket.live, 1)
+	socket.setState(StateConnected)
+	conn.EnableWriteCompression(socket.compressWrites())
+	if level := socket.ConnectionOptions.CompressionLevel; level != 0 {
+		conn.SetCompressionLevel(level)
+	}
+	if err := checkSubprotocol(conn, resp, socket.ConnectionOptions.Subprotocols); err != nil {
+		socket.log.warning(err)
+		if socket.OnSubprotocolMismatch != nil {
+			socket.reconnectCallback(attempt, func() { socket.OnSubprotocolMismatch(err, socket) })
+		}
 	}
+	if onConnected := socket.snapshot().OnConnected; onConnected != nil {
+		socket.reconnectCallback(attempt, func() { onConnected(socket) })
+	}
+	// Released after OnConnected so waiters observe its side effects.
+	socket.ready.release()
 	return
 }
 
+// isNotTLS reports whether err is a TLS handshake that failed because the
+// server replied with something other than a TLS record.
+func isNotTLS(err error) bool {
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &recordErr)
+}
+
+// downgradeURL turns a wss URL into the equivalent ws URL.
+func downgradeURL(rawURL string) string {
+	return "ws" + rawURL[len("wss"):]
+}
+
+// checkSubprotocol verifies that the raw handshake response agrees with the
+// subprotocol gorilla reports for conn and that it is one the client offered.
+func checkSubprotocol(conn connection, resp *http.Response, offers []string) error {
+	negotiated := conn.Subprotocol()
+	header := strings.Join(resp.Header.Values("Sec-Websocket-Protocol"), ", ")
+	if header != negotiated {
+		return fmt.Errorf("%w: response header %q, connection %q", ErrSubprotocolMismatch, header, negotiated)
+	}
+	if negotiated == "" {
+		return nil
+	}
+	for _, offered := range offers {
+		if offered == negotiated {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: server selected %q which was not offered", ErrSubprotocolMismatch, negotiated)
+}
+
+// TLSConnectionState returns the negotiated TLS state of a wss connection.
+// The boolean is false when not connected or the connection is not TLS.
+func (socket *Socket) TLSConnectionState() (tls.ConnectionState, bool) {
+	conn := socket.conn()
+	if conn == nil {
+		return tls.ConnectionState{}, false
+	}
+	tlsConn, ok := conn.UnderlyingConn().(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
+}
+
+// Subprotocol returns the subprotocol the server selected from
+// ConnectionOptions.Subprotocols, or "" if it selected none or the socket is
+// not connected. Each reconnect may select differently; OnConnected sees the
+// value for the connection it reports.
+func (socket *Socket) Subprotocol() string {
+	conn := socket.conn()
+	if conn == nil || !socket.IsConnected() {
+		return ""
+	}
+	return conn.Subprotocol()
+}
+
+// SetReconnectionOptions replaces the reconnection options safely while a
+// reconnect loop may be running; the change applies from the next attempt.
+func (socket *Socket) SetReconnectionOptions(options ReconnectionOptions) {
+	socket.reconnectMu.Lock()
+	socket.ReconnectionOptions = options
+	socket.reconnectMu.Unlock()
+}
+
+func (socket *Socket) reconnectionOptions() ReconnectionOptions {
+	socket.reconnectMu.Lock()
+	defer socket.reconnectMu.Unlock()
+	return socket.ReconnectionOptions
+}
+
+// Reconnect replaces a lost connection, retrying as configured by
+// ReconnectionOptions. If no attempt succeeds it returns the last attempt's
+// error, ErrReconnectTimeout once MaxElapsedTime has run out, or ErrClosed
+// if the socket was closed meanwhile, and the socket stays disconnected. It
+// returns nil straight away if the socket is connected or another Reconnect
+// is in progress.
 func (socket *Socket) Reconnect() (err error) {
-	if !atomic.CompareAndSwapInt32(&reconnectFlag, 0, 1) {
+	if socket.IsConnected() || socket.isClosed() {
 		return
 	}
+	if socket.reconnectionOptions().Times < 0 {
+		return ErrReconnectDisabled
+	}
 
-	if socket.IsConnected {
+	if !atomic.CompareAndSwapInt32(socket.reconnecting, 0, 1) {
 		return
 	}
+	socket.setState(StateReconnecting)
+
+	socket.running.begin()
+	defer socket.running.end()
+	defer socket.reconnect.end(socket.reconnect.begin())
+	ctx, cancel := socket.closedContext(context.Background())
+	defer cancel()
+	if conn := socket.conn(); conn != nil {
+		// Unblock a receive loop still reading the broken connection.
+		conn.Close()
+	}
 
+	started := time.Now()
 	reconnectCnt := 0
 	for {
-		time.Sleep(socket.ReconnectionOptions.Interval)
+		options := socket.reconnectionOptions()
+		if socket.breaker.trip(options.CircuitBreaker, time.Now()) {
+			socket.log.warning("Circuit breaker open, pausing reconnection for", options.CircuitBreaker.Cooldown)
+			if socket.OnCircuitOpen != nil {
+				socket.reconnect.callback(func() { socket.OnCircuitOpen(socket) })
+			}
+			if options.outOfTime(started, options.CircuitBreaker.Cooldown) {
+				err = ErrReconnectTimeout
+				break
+			}
+			if !socket.sleep(options.CircuitBreaker.Cooldown) {
+				err = ErrClosed
+				break
+			}
+		}
+		delay := options.delay(reconnectCnt + 1)
+		if options.outOfTime(started, delay) {
+			err = ErrReconnectTimeout
+			break
+		}
+		if !socket.sleep(delay) {
+			err = ErrClosed
+			break
+		}
 
 		reconnectCnt++
-		err = socket.DoConnect()
+		socket.traceEvent(TraceEvent{Type: TraceReconnecting, Attempt: reconnectCnt})
+		if socket.OnReconnecting != nil {
+			socket.reconnect.callback(func() { socket.OnReconnecting(reconnectCnt, socket) })
+		}
+		attemptCtx, cancelAttempt := options.attemptContext(ctx, started)
+		err = socket.doConnect(attemptCtx, reconnectCnt)
+		cancelAttempt()
+		if socket.isClosed() {
+			if err == nil {
+				socket.conn().Close()
+			}
+			err = ErrClosed
+			break
+		}
+		socket.stats.reconnectAttempted(err == nil, options.SuccessRateWindow)
+		if err == nil {
+			atomic.AddUint64(&socket.stats.reconnects, 1)
+		}
 
-		if socket.ReconnectionOptions.Times > 0 && reconnectCnt >= socket.ReconnectionOptions.Times {
+		if options.Times > 0 && reconnectCnt >= options.Times {
 			break
 		}
 
@@ -137,90 +748,558 @@ func (socket *Socket) Reconnect() (err error) {
 		break
 	}
 
-	atomic.CompareAndSwapInt32(&reconnectFlag, 1, 0)
+	if err != nil {
+		// The broken connection was kept while attempts ran; drop it before
+		// clearing reconnecting so sends fail with ErrNotConnected instead
+		// of starting another Reconnect.
+		socket.handlerMu.Lock()
+		socket.Conn = nil
+		socket.handlerMu.Unlock()
+	}
+	atomic.StoreInt32(socket.reconnecting, 0)
 
-	socket.IsConnected = true
-	return
+	if err != nil {
+		// Every attempt failed, or the socket was closed meanwhile. The old
+		// receive loop has exited and no new one was started.
+		socket.setState(StateDisconnected)
+		socket.release()
+		if err != ErrClosed {
+			socket.requests.fail(ErrRequestInterrupted)
+		}
+		if err == ErrReconnectTimeout {
+			socket.log.error("Giving up reconnecting after", time.Since(started))
+			if onDisconnected := socket.snapshot().OnDisconnected; onDisconnected != nil {
+				socket.reconnect.callback(func() { onDisconnected(err, socket) })
+			}
+		}
+		return err
+	}
+	socket.start(nil)
+	socket.resendUnacked()
+	socket.flushSendQueue()
+	socket.retryRequests()
+	if socket.OnReconnected != nil {
+		socket.reconnect.callback(func() { socket.OnReconnected(socket) })
+	}
+	return nil
+}
+
+// Connect dials the server and starts receiving. The dial error, if any, is
+// returned as well as passed to OnConnectError. While another Connect is
+// dialing, or once connected, it fails with ErrAlreadyConnecting or
+// ErrAlreadyConnected without dialing, and after Close with ErrClosed.
+func (socket *Socket) Connect() error {
+	err := socket.DoConnect()
+
+	if err != nil {
+		return err
+	}
+
+	socket.flushSendQueue()
+	socket.retryRequests()
+	if socket.ManualRecvStart {
+		socket.deferStart()
+		return nil
+	}
+	socket.start(nil)
+	return nil
+}
+
+// ConnectContext connects like Connect, abandoning the dial if ctx is
+// cancelled first. Once connected, cancelling ctx closes the socket as Close
+// does, so it can be tied to an application's shutdown.
+func (socket *Socket) ConnectContext(ctx context.Context) error {
+	dialCtx, cancel := socket.closedContext(ctx)
+	err := socket.doConnect(dialCtx, 0)
+	cancel()
+
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			socket.Close()
+		case <-socket.done:
+		}
+	}()
+	socket.flushSendQueue()
+	socket.retryRequests()
+	if socket.ManualRecvStart {
+		socket.deferStart()
+		return nil
+	}
+	socket.start(nil)
+	return nil
 }
 
-func (socket *Socket) Connect() {
+// ConnectSync connects like Connect but only returns once the handlers are
+// bound and the receive goroutine is running, so messages can be sent
+// immediately without racing the setup.
+func (socket *Socket) ConnectSync() error {
 	err := socket.DoConnect()
 
 	if err != nil {
+		return err
+	}
+
+	socket.flushSendQueue()
+	socket.retryRequests()
+	if socket.ManualRecvStart {
+		socket.deferStart()
+		return nil
+	}
+	started := make(chan struct{})
+	socket.start(started)
+	<-started
+	return nil
+}
+
+// deferStart binds the handlers but leaves starting the receive loop to
+// StartReceiving.
+func (socket *Socket) deferStart() {
+	socket.bind()
+	atomic.StoreInt32(socket.recvPending, 1)
+}
+
+// StartReceiving starts the receive loop deferred by ManualRecvStart.
+// Messages that arrived in the meantime are buffered by the connection and
+// delivered from here on. It does nothing if no start is pending.
+func (socket *Socket) StartReceiving() {
+	if !atomic.CompareAndSwapInt32(socket.recvPending, 1, 0) {
 		return
 	}
+	socket.run(nil)
+}
 
+func (socket *Socket) start(started chan struct{}) {
 	socket.bind()
-	go socket.recv()
+	socket.run(started)
+}
+
+// run counts the socket as active and launches the receive loop and, if
+// enabled, the keepalive.
+func (socket *Socket) run(started chan struct{}) {
+	if atomic.CompareAndSwapInt32(socket.active, 0, 1) {
+		atomic.AddInt32(&activeSockets, 1)
+	}
+	socket.running.begin()
+	go socket.recv(started)
+	if socket.KeepAlive > 0 {
+		go socket.keepAlive(socket.conn(), socket.KeepAlive)
+	}
 }
 
 func (socket *Socket) bind() {
-	defaultPingHandler := socket.Conn.PingHandler()
-	socket.Conn.SetPingHandler(func(appData string) error {
-		logger.Trace.Println("Received PING from server")
+	conn := socket.conn()
+	if socket.MaxMessageSize > 0 {
+		conn.SetReadLimit(socket.MaxMessageSize)
+	}
+	defaultPingHandler := conn.PingHandler()
+	conn.SetPingHandler(func(appData string) error {
+		socket.log.trace("Received PING from server")
+		socket.touchRead(conn)
+		// Pong before running the callbacks, and under pongMu, so that a
+		// Close from a callback or another goroutine cannot put the close
+		// frame ahead of it.
+		socket.stats.inbound.count(websocket.PingMessage)
+		socket.pongMu.Lock()
+		err := defaultPingHandler(appData)
+		socket.pongMu.Unlock()
+		if err == nil {
+			socket.stats.outbound.count(websocket.PongMessage)
+		}
 		if socket.OnPingReceived != nil {
-			socket.OnPingReceived(appData, *socket)
+			socket.safely("OnPingReceived", func() { socket.OnPingReceived(appData, socket) })
 		}
-		return defaultPingHandler(appData)
+		if socket.OnPingReceivedBytes != nil {
+			socket.safely("OnPingReceivedBytes", func() { socket.OnPingReceivedBytes([]byte(appData), socket) })
+		}
+		return err
 	})
 
-	defaultPongHandler := socket.Conn.PongHandler()
-	socket.Conn.SetPongHandler(func(appData string) error {
-		logger.Trace.Println("Received PONG from server")
+	defaultPongHandler := conn.PongHandler()
+	conn.SetPongHandler(func(appData string) error {
+		socket.log.trace("Received PONG from server")
+		socket.touchRead(conn)
+		socket.stats.inbound.count(websocket.PongMessage)
+		atomic.StoreInt64(socket.lastPong, time.Now().UnixNano())
+		socket.traceEvent(TraceEvent{Type: TracePongReceived, Size: len(appData)})
+		socket.stats.pongReceived(time.Now())
 		if socket.OnPongReceived != nil {
-			socket.OnPongReceived(appData, *socket)
+			socket.safely("OnPongReceived", func() { socket.OnPongReceived(appData, socket) })
+		}
+		if socket.OnPongReceivedBytes != nil {
+			socket.safely("OnPongReceivedBytes", func() { socket.OnPongReceivedBytes([]byte(appData), socket) })
 		}
 		return defaultPongHandler(appData)
 	})
 
-	defaultCloseHandler := socket.Conn.CloseHandler()
-	socket.Conn.SetCloseHandler(func(code int, text string) error {
+	defaultCloseHandler := conn.CloseHandler()
+	conn.SetCloseHandler(func(code int, text string) error {
+		socket.stats.inbound.count(websocket.CloseMessage)
 		result := defaultCloseHandler(code, text)
-		logger.Warning.Println("Disconnected from server ", result)
-		if socket.OnDisconnected != nil {
-			socket.IsConnected = false
-			socket.OnDisconnected(errors.New(text), *socket)
+		if result == nil {
+			socket.stats.outbound.count(websocket.CloseMessage)
+		}
+		socket.log.warning("Disconnected from server ", result)
+		if socket.isFatalCloseCode(code) {
+			socket.log.error("Server closed with fatal code", code, "- not reconnecting")
+			socket.markClosed()
+			socket.disconnected(&FatalCloseError{Code: code, Text: text})
+			return result
 		}
+		socket.disconnected(&CloseError{Code: code, Text: text})
 		return result
 	})
 }
 
-func (socket *Socket) recv() {
+func (socket *Socket) reportError(err error) {
+	socket.stats.errorReported(time.Now(), socket.reconnectionOptions().SuccessRateWindow)
+	if socket.OnError != nil {
+		socket.OnError(err, socket)
+	}
+}
+
+// disconnected records a lost connection and notifies OnDisconnected.
+func (socket *Socket) disconnected(err error) {
+	socket.disconnectedAs(classifyDisconnect(err), err)
+}
+
+// disconnectedAs is disconnected for errors whose category cannot be told
+// from the error itself. Only the first report for a connection reaches
+// Stats, OnTrace and OnDisconnected: a close frame from the server, for one,
+// is followed by a read error, and Close may come after the connection was
+// lost.
+func (socket *Socket) disconnectedAs(category DisconnectCategory, err error) {
+	socket.ready.rearm()
+	if atomic.LoadInt32(socket.reconnecting) == 0 {
+		socket.setState(StateDisconnected)
+	}
+	if !atomic.CompareAndSwapInt32(socket.live, 1, 0) {
+		return
+	}
+	if !socket.isClosed() {
+		socket.requests.interrupted(socket.RetryRequestsOnReconnect)
+	}
+	socket.stats.disconnected(category, err)
+	socket.traceEvent(TraceEvent{Type: TraceDisconnected, Err: err})
+	if onDisconnected := socket.snapshot().OnDisconnected; onDisconnected != nil {
+		onDisconnected(err, socket)
+	}
+}
+
+// IsConnected reports whether the socket currently has a live connection,
+// i.e. whether State is StateConnected. It is safe to call from any
+// goroutine.
+func (socket *Socket) IsConnected() bool {
+	return socket.State() == StateConnected
+}
+
+// SetTextMessageHandler replaces OnTextMessage safely while messages are
+// being dispatched; the new handler applies from the next message.
+func (socket *Socket) SetTextMessageHandler(handler func(message string, socket *Socket)) {
+	socket.handlerMu.Lock()
+	socket.OnTextMessage = handler
+	socket.handlerMu.Unlock()
+}
+
+// SetBinaryMessageHandler is the OnBinaryMessage counterpart of
+// SetTextMessageHandler.
+func (socket *Socket) SetBinaryMessageHandler(handler func(data []byte, socket *Socket)) {
+	socket.handlerMu.Lock()
+	socket.OnBinaryMessage = handler
+	socket.handlerMu.Unlock()
+}
+
+// SetMessageHandler is the OnMessage counterpart of SetTextMessageHandler.
+func (socket *Socket) SetMessageHandler(handler func(messageType int, data []byte, socket *Socket)) {
+	socket.handlerMu.Lock()
+	socket.OnMessage = handler
+	socket.handlerMu.Unlock()
+}
+
+// SetMessageReaderHandler is the OnMessageReader counterpart of
+// SetTextMessageHandler.
+func (socket *Socket) SetMessageReaderHandler(handler func(messageType int, reader io.Reader, socket *Socket)) {
+	socket.handlerMu.Lock()
+	socket.OnMessageReader = handler
+	socket.handlerMu.Unlock()
+}
+
+// SetConnectedHandler replaces OnConnected safely while the socket is in
+// use; the new handler applies from the next connect.
+func (socket *Socket) SetConnectedHandler(handler func(socket *Socket)) {
+	socket.handlerMu.Lock()
+	socket.OnConnected = handler
+	socket.handlerMu.Unlock()
+}
+
+// SetConnectErrorHandler is the OnConnectError counterpart of
+// SetConnectedHandler.
+func (socket *Socket) SetConnectErrorHandler(handler func(err error, socket *Socket)) {
+	socket.handlerMu.Lock()
+	socket.OnConnectError = handler
+	socket.handlerMu.Unlock()
+}
+
+// SetDisconnectedHandler is the OnDisconnected counterpart of
+// SetConnectedHandler.
+func (socket *Socket) SetDisconnectedHandler(handler func(err error, socket *Socket)) {
+	socket.handlerMu.Lock()
+	socket.OnDisconnected = handler
+	socket.handlerMu.Unlock()
+}
+
+// conn returns the current connection, or nil before the first successful
+// connect. A reconnect may replace it at any time, so callers load it once
+// and use that value throughout.
+func (socket *Socket) conn() connection {
+	socket.handlerMu.RLock()
+	defer socket.handlerMu.RUnlock()
+	return socket.Conn
+}
+
+// handlers holds the callbacks that the receive loop and the connect paths
+// read through snapshot.
+type handlers struct {
+	OnConnected           func(socket *Socket)
+	OnConnectError        func(err error, socket *Socket)
+	OnDisconnected        func(err error, socket *Socket)
+	OnTextMessage         func(message string, socket *Socket)
+	OnBinaryMessage       func(data []byte, socket *Socket)
+	OnMessage             func(messageType int, data []byte, socket *Socket)
+	OnMessageReader       func(messageType int, reader io.Reader, socket *Socket)
+	OnJSONMessage         func(data json.RawMessage, socket *Socket)
+	OnBatch               func(messages []Message, socket *Socket)
+	OnUnexpectedFrameType func(got int, socket *Socket)
+}
+
+// snapshot copies the handlers under handlerMu so that reading them never
+// races with the Set*Handler methods.
+func (socket *Socket) snapshot() handlers {
+	socket.handlerMu.RLock()
+	defer socket.handlerMu.RUnlock()
+	return handlers{
+		OnConnected:           socket.OnConnected,
+		OnConnectError:        socket.OnConnectError,
+		OnDisconnected:        socket.OnDisconnected,
+		OnTextMessage:         socket.OnTextMessage,
+		OnBinaryMessage:       socket.OnBinaryMessage,
+		OnMessage:             socket.OnMessage,
+		OnMessageReader:       socket.OnMessageReader,
+		OnJSONMessage:         socket.OnJSONMessage,
+		OnBatch:               socket.OnBatch,
+		OnUnexpectedFrameType: socket.OnUnexpectedFrameType,
+	}
+}
+
+func (socket *Socket) recv(started chan struct{}) {
+	defer socket.running.end()
 	for {
+		if started != nil {
+			close(started)
+			started = nil
+		}
+		conn := socket.conn()
 		socket.receiveMu.Lock()
-		if socket.Timeout != 0 {
-			socket.Conn.SetReadDeadline(time.Now().Add(socket.Timeout))
+		socket.startRead(conn)
+		messageType, reader, err := conn.NextReader()
+		// Taken once the frame has arrived, so that a handler set while
+		// waiting for it applies to it.
+		current := socket.snapshot()
+		var message []byte
+		var buffer *bytes.Buffer
+		if err == nil && socket.ReuseReceiveBuffers {
+			buffer = getReceiveBuffer()
+			_, err = buffer.ReadFrom(reader)
+			message = buffer.Bytes()
+			reader = bytes.NewReader(message)
+		} else if err == nil && current.OnMessageReader == nil {
+			message, err = ioutil.ReadAll(reader)
 		}
-		messageType, message, err := socket.Conn.ReadMessage()
 		socket.receiveMu.Unlock()
 		if err != nil {
-			logger.Error.Println("read:", err)
-			if socket.OnDisconnected != nil {
-				socket.IsConnected = false
-				socket.OnDisconnected(err, *socket)
+			putReceiveBuffer(buffer)
+		}
+		if err != nil && socket.isClosed() {
+			conn.Close()
+			socket.release()
+			return
+		}
+		if err != nil && (conn != socket.conn() || atomic.LoadInt32(socket.reconnecting) == 1) {
+			// The connection was already replaced, or is being, by a
+			// Reconnect started elsewhere, which runs its own receive loop.
+			return
+		}
+		if err != nil {
+			socket.log.error("read:", err)
+			socket.reportError(newConnError("read", err))
+			socket.disconnected(err)
+			if socket.reconnectionOptions().Times < 0 {
+				socket.markClosed()
+				conn.Close()
+				socket.release()
+				return
+			}
+			if socket.ManualReconnect {
+				conn.Close()
+				socket.release()
+				return
 			}
+			// A successful Reconnect binds the new connection and starts a
+			// receive loop for it, so this one is done either way.
 			socket.Reconnect()
-			continue
+			return
 		}
-		logger.Info.Println("recv: %s", message)
+		socket.stats.inbound.count(messageType)
+		if socket.inbound.exceeded(socket.MaxInboundRate, time.Now()) {
+			putReceiveBuffer(buffer)
+			socket.log.error("Inbound message rate exceeded, closing")
+			socket.abort(websocket.ClosePolicyViolation, "message rate exceeded", ErrInboundRateExceeded)
+			return
+		}
+		if socket.StrictMode && messageType == websocket.TextMessage && message != nil && !utf8.Valid(message) {
+			putReceiveBuffer(buffer)
+			socket.log.error("Invalid UTF-8 in text frame, closing")
+			socket.abort(websocket.CloseInvalidFramePayloadData, "invalid UTF-8", &ProtocolError{Code: websocket.CloseInvalidFramePayloadData, Reason: "invalid UTF-8 in text frame"})
+			return
+		}
+		socket.traceEvent(TraceEvent{Type: TraceMessageReceived, Size: len(message)})
+		socket.dispatch(current, messageType, reader, message)
+		putReceiveBuffer(buffer)
+	}
+}
 
-		switch messageType {
-		case websocket.TextMessage:
-			if socket.OnTextMessage != nil {
-				socket.OnTextMessage(string(message), *socket)
-			}
-		case websocket.BinaryMessage:
-			if socket.OnBinaryMessage != nil {
-				socket.OnBinaryMessage(message, *socket)
+// dispatch hands a received frame to the handlers captured in current. When
+// receive buffers are reused, message and reader are only valid until
+// dispatch returns.
+func (socket *Socket) dispatch(current handlers, messageType int, reader io.Reader, message []byte) {
+	if socket.ExpectedMessageType != 0 && messageType != socket.ExpectedMessageType {
+		socket.log.warning("Unexpected frame type", messageType)
+		if current.OnUnexpectedFrameType != nil {
+			socket.safely("OnUnexpectedFrameType", func() { current.OnUnexpectedFrameType(messageType, socket) })
+		}
+		return
+	}
+	if messageType == websocket.TextMessage && socket.requests.waiting() {
+		if message == nil {
+			message, _ = ioutil.ReadAll(reader)
+			reader = bytes.NewReader(message)
+		}
+		if socket.requests.deliver(message) {
+			socket.stats.received(len(message))
+			return
+		}
+	}
+	if socket.firstMessage != nil {
+		if first := socket.takeFirstMessage(); first != nil {
+			if message == nil {
+				message, _ = ioutil.ReadAll(reader)
 			}
+			socket.stats.received(len(message))
+			first <- firstMessage{messageType, append([]byte(nil), message...)}
+			return
+		}
+	}
+	if socket.messages.enabled() {
+		if message == nil {
+			message, _ = ioutil.ReadAll(reader)
+		} else if socket.ReuseReceiveBuffers {
+			message = append([]byte(nil), message...)
+		}
+		socket.stats.received(len(message))
+		socket.messages.deliver(Message{Type: messageType, Data: message}, socket.done)
+		return
+	}
+	if current.OnBatch != nil {
+		if message == nil {
+			message, _ = ioutil.ReadAll(reader)
+		} else if socket.ReuseReceiveBuffers {
+			message = append([]byte(nil), message...)
+		}
+		socket.stats.received(len(message))
+		socket.queueBatch(Message{Type: messageType, Data: message})
+		return
+	}
+	if current.OnMessageReader != nil {
+		counter := &countingReader{reader: reader}
+		socket.safely("OnMessageReader", func() { current.OnMessageReader(messageType, counter, socket) })
+		socket.stats.received(counter.n)
+		return
+	}
+	socket.stats.received(len(message))
+	socket.log.info("recv:", string(message))
+
+	if current.OnMessage != nil {
+		socket.safely("OnMessage", func() { current.OnMessage(messageType, message, socket) })
+	}
+	switch messageType {
+	case websocket.TextMessage:
+		if current.OnTextMessage != nil {
+			start := time.Now()
+			socket.safely("OnTextMessage", func() { current.OnTextMessage(string(message), socket) })
+			socket.stats.textCallback.observe(time.Since(start))
+		}
+		if current.OnJSONMessage != nil {
+			socket.safely("OnJSONMessage", func() { current.OnJSONMessage(json.RawMessage(message), socket) })
+		}
+		if current.OnTextMessage == nil && current.OnJSONMessage == nil && current.OnMessage == nil {
+			socket.warnDropped("text")
+		}
+	case websocket.BinaryMessage:
+		if current.OnBinaryMessage != nil {
+			start := time.Now()
+			socket.safely("OnBinaryMessage", func() { current.OnBinaryMessage(message, socket) })
+			socket.stats.binaryCallback.observe(time.Since(start))
+		} else if current.OnMessage == nil {
+			socket.warnDropped("binary")
 		}
 	}
 }
 
+// safely runs the callback named name, recovering from a panic in it so
+// that one bad message cannot stop the receive loop. The panic is logged and
+// reported to OnError as a *CallbackPanicError.
+func (socket *Socket) safely(name string, callback func()) {
+	defer func() {
+		if value := recover(); value != nil {
+			err := &CallbackPanicError{Callback: name, Value: value, Stack: debug.Stack()}
+			socket.log.error(err)
+			socket.reportError(err)
+		}
+	}()
+	callback()
+}
+
+// warnDropped logs and reports, once per socket, that a message was dropped
+// for lack of a handler when WarnOnMissingHandlers is set.
+func (socket *Socket) warnDropped(kind string) {
+	if socket.WarnOnMissingHandlers && atomic.CompareAndSwapInt32(socket.warnedDropped, 0, 1) {
+		socket.log.warning("Dropped", kind, "message: no handler is set; set handlers before calling Connect")
+		socket.reportError(fmt.Errorf("%w: dropped %s message", ErrNoHandler, kind))
+	}
+}
+
 func (socket *Socket) SendText(message string) error {
-	err := socket.send(websocket.TextMessage, []byte (message))
+	err := socket.send(websocket.TextMessage, []byte(message))
+	if err != nil {
+		socket.log.error("write:", err)
+	}
+	return err
+}
+
+// SendJSON marshals v and sends it as a text message. A marshalling error
+// is returned without writing anything.
+func (socket *Socket) SendJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = socket.send(websocket.TextMessage, data)
 	if err != nil {
-		logger.Error.Println("write:", err)
+		socket.log.error("write:", err)
 	}
 	return err
 }
@@ -228,43 +1307,443 @@ func (socket *Socket) SendText(message string) error {
 func (socket *Socket) SendBinary(data []byte) error {
 	err := socket.send(websocket.BinaryMessage, data)
 	if err != nil {
-		logger.Error.Println("write:", err)
+		socket.log.error("write:", err)
 	}
 	return err
 }
 
-func (socket *Socket) send(messageType int, data []byte) error {
-	socket.sendMu.Lock()
-	err := socket.Conn.WriteMessage(messageType, data)
+// SendOptions holds the per-message settings of SendWithOptions.
+type SendOptions struct {
+	// Binary sends a binary message instead of a text one.
+	Binary bool
+	// Compress, when set, overrides whether this message is compressed. It
+	// has no effect unless compression was negotiated.
+	Compress *bool
+	// Deadline, when set, fails the write if it has not completed by then.
+	Deadline time.Time
+}
+
+// SendWithOptions sends data as configured by opts. The options apply to the
+// write made by this call, including its retry after a reconnect; a message
+// that ends up in the send queue or is resent by ResendUnackedOnReconnect is
+// written with the socket's defaults.
+func (socket *Socket) SendWithOptions(data []byte, opts SendOptions) error {
+	messageType := websocket.TextMessage
+	if opts.Binary {
+		messageType = websocket.BinaryMessage
+	}
+	err := socket.sendWith(messageType, data, &opts)
 	if err != nil {
-		logger.Error.Println("send:", err)
-		if socket.OnDisconnected != nil {
-			socket.IsConnected = false
-			socket.OnDisconnected(err, *socket)
+		socket.log.error("write:", err)
+	}
+	return err
+}
+
+// SendTextWithDeadline sends a text message like SendText, failing with a
+// timeout error if the write has not completed within d.
+func (socket *Socket) SendTextWithDeadline(message string, d time.Duration) error {
+	return socket.SendWithOptions([]byte(message), SendOptions{Deadline: time.Now().Add(d)})
+}
+
+// SendBinaryWithDeadline is the binary counterpart of SendTextWithDeadline.
+func (socket *Socket) SendBinaryWithDeadline(data []byte, d time.Duration) error {
+	return socket.SendWithOptions(data, SendOptions{Binary: true, Deadline: time.Now().Add(d)})
+}
+
+// SendTextBatch sends messages in order while holding the send lock once,
+// so other sends cannot interleave and the lock is not contended per
+// message. Each write gets its own Timeout deadline. It stops at the first
+// failure and returns a *SendBatchError counting the messages sent before
+// it; the rest are not attempted. A message that failed to be written or
+// queued goes to OnSendFailed, and a broken connection is handled as for
+// SendText, without the resend.
+func (socket *Socket) SendTextBatch(messages []string) error {
+	socket.sendMu.Lock()
+	delivered := make([]uint64, 0, len(messages))
+	sent := 0
+	var messageType int
+	var data []byte
+	var err, sendErr, writeErr error
+	for _, message := range messages {
+		messageType, data, err = socket.intercept(websocket.TextMessage, []byte(message))
+		if err != nil {
+			break
+		}
+		id := atomic.AddUint64(socket.messageID, 1)
+		if socket.SendQueueSize > 0 && (!socket.IsConnected() || socket.queue.len() > 0) {
+			sendErr = socket.enqueue(id, messageType, data)
+		} else if sendErr = socket.waitForWindow(); sendErr == nil {
+			if sendErr = socket.write(id, messageType, data, nil); sendErr == nil {
+				delivered = append(delivered, id)
+			} else {
+				writeErr = sendErr
+			}
+		}
+		if err = sendErr; err != nil {
+			break
 		}
-		socket.Reconnect()
+		sent++
+	}
+	socket.sendMu.Unlock()
 
-		if socket.IsConnected {
-			socket.Conn.WriteMessage(messageType, data)
+	if socket.OnDelivered != nil {
+		for _, id := range delivered {
+			socket.OnDelivered(id, socket)
 		}
 	}
+	if err == nil {
+		return nil
+	}
+	if writeErr != nil {
+		socket.writeFailed(writeErr)
+	}
+	if sendErr != nil && socket.OnSendFailed != nil {
+		socket.OnSendFailed(messageType, data, err, socket)
+	}
+	return &SendBatchError{Sent: sent, Err: err}
+}
+
+func (socket *Socket) send(messageType int, data []byte) error {
+	return socket.sendWith(messageType, data, nil)
+}
+
+// sendWith sends a message, applying opts to its writes if not nil.
+func (socket *Socket) sendWith(messageType int, data []byte, opts *SendOptions) error {
+	if err := socket.lockWithinWindow(messageType); err != nil {
+		return err
+	}
+	messageType, data, err := socket.intercept(messageType, data)
+	if err != nil {
+		socket.sendMu.Unlock()
+		return err
+	}
+	var id uint64
+	if isDataMessage(messageType) {
+		id = atomic.AddUint64(socket.messageID, 1)
+	}
+	if socket.SendQueueSize > 0 && (!socket.IsConnected() || socket.queue.len() > 0) {
+		err := socket.enqueue(id, messageType, data)
+		socket.sendMu.Unlock()
+		return err
+	}
+	err = socket.write(id, messageType, data, opts)
 	socket.sendMu.Unlock()
+
+	if err != nil && !isConnectionError(err) {
+		// The message itself was rejected; the connection is fine and
+		// resending it would fail the same way.
+		socket.log.error("send:", err)
+		socket.reportError(newConnError("write", err))
+	} else if err != nil {
+		socket.log.error("send:", err)
+		socket.reportError(newConnError("write", err))
+		socket.disconnectedAs(DisconnectWriteFailure, err)
+		socket.recoverConnection()
+
+		if socket.IsConnected() {
+			socket.sendMu.Lock()
+			err = socket.write(id, messageType, data, opts)
+			socket.sendMu.Unlock()
+		} else if socket.SendQueueSize > 0 {
+			socket.sendMu.Lock()
+			err = socket.enqueue(id, messageType, data)
+			socket.sendMu.Unlock()
+			if err == nil {
+				return nil
+			}
+		}
+	}
+
+	if err != nil && socket.OnSendFailed != nil {
+		socket.OnSendFailed(messageType, data, err, socket)
+	}
+	if err == nil && id != 0 && socket.OnDelivered != nil {
+		socket.OnDelivered(id, socket)
+	}
 	return err
 }
 
-func (socket *Socket) close() error {
-	err := socket.send(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+// write writes a single message and records it; sendMu must be held.
+func (socket *Socket) write(id uint64, messageType int, data []byte, opts *SendOptions) error {
+	conn := socket.conn()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	if socket.Timeout != 0 && (opts == nil || opts.Deadline.IsZero()) {
+		var withTimeout SendOptions
+		if opts != nil {
+			withTimeout = *opts
+		}
+		withTimeout.Deadline = time.Now().Add(socket.Timeout)
+		opts = &withTimeout
+	}
+	if opts != nil {
+		defer socket.applySendOptions(conn, opts)()
+	}
+	atomic.StoreInt64(socket.writeStarted, time.Now().UnixNano())
+	err := conn.WriteMessage(messageType, data)
+	atomic.StoreInt64(socket.writeStarted, 0)
+	if err == nil {
+		socket.stats.outbound.count(messageType)
+	}
+	if err != nil || id == 0 {
+		return err
+	}
+	socket.sent(id, len(data))
+	if socket.ResendUnackedOnReconnect || socket.AckWindow > 0 {
+		socket.unacked.add(id, messageType, data)
+	}
+	return nil
+}
+
+// sent records that the data message id, of size bytes, was written.
+func (socket *Socket) sent(id uint64, size int) {
+	socket.traceEvent(TraceEvent{Type: TraceMessageSent, Size: size})
+	for {
+		last := atomic.LoadUint64(socket.lastSentID)
+		if id <= last || atomic.CompareAndSwapUint64(socket.lastSentID, last, id) {
+			break
+		}
+	}
+	socket.stats.sent(size)
+}
+
+// applySendOptions sets up conn for a write with opts and returns a function
+// restoring the defaults afterwards; sendMu must be held.
+func (socket *Socket) applySendOptions(conn connection, opts *SendOptions) (restore func()) {
+	if opts.Compress != nil {
+		conn.EnableWriteCompression(*opts.Compress)
+	}
+	if !opts.Deadline.IsZero() {
+		conn.SetWriteDeadline(opts.Deadline)
+	}
+	return func() {
+		if opts.Compress != nil {
+			conn.EnableWriteCompression(socket.compressWrites())
+		}
+		if !opts.Deadline.IsZero() {
+			conn.SetWriteDeadline(time.Time{})
+		}
+	}
+}
+
+func isDataMessage(messageType int) bool {
+	return messageType == websocket.TextMessage || messageType == websocket.BinaryMessage
+}
+
+// LastSentID returns the highest ID of the text or binary messages written
+// to the connection. IDs start at 1 and increase by one per message in the
+// order sends are made; 0 means nothing has been sent yet.
+func (socket *Socket) LastSentID() uint64 {
+	return atomic.LoadUint64(socket.lastSentID)
+}
+
+// SendPing writes a ping frame. Control frames bypass sendMu (gorilla allows
+// WriteControl concurrently with other writes), so they are not held up by
+// large or slow data writes. A failure that breaks the connection is
+// handled like one of a data write: it is reported to OnError and
+// OnDisconnected and the socket reconnects.
+func (socket *Socket) SendPing(data []byte, deadline time.Time) error {
+	socket.stats.pingSent(time.Now())
+	err := socket.sendControl(websocket.PingMessage, data, deadline)
 	if err != nil {
-		logger.Error.Println("write close:", err)
+		socket.stats.pingSent(time.Time{})
+		return err
+	}
+	socket.traceEvent(TraceEvent{Type: TracePingSent, Size: len(data)})
+	return nil
+}
+
+// SendPong writes an unsolicited pong frame, see SendPing.
+func (socket *Socket) SendPong(data []byte, deadline time.Time) error {
+	return socket.sendControl(websocket.PongMessage, data, deadline)
+}
+
+// sendControl writes a control frame, handling failures the way sendWith
+// does minus the retry: a ping or pong is not worth repeating on the new
+// connection.
+func (socket *Socket) sendControl(messageType int, data []byte, deadline time.Time) error {
+	err := socket.writeControl(messageType, data, deadline)
+	if err == nil || err == ErrNotConnected {
+		return err
 	}
-	socket.Conn.Close()
+	socket.writeFailed(err)
 	return err
 }
 
+func (socket *Socket) writeControl(messageType int, data []byte, deadline time.Time) error {
+	conn := socket.conn()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	err := conn.WriteControl(messageType, data, deadline)
+	if err == nil {
+		socket.stats.outbound.count(messageType)
+	}
+	return err
+}
+
+// abort closes the socket for good with code and text, reporting err to
+// OnError and OnDisconnected. It is called from the receive goroutine when
+// the peer misbehaves.
+func (socket *Socket) abort(code int, text string, err error) {
+	socket.markClosed()
+	socket.closeWith(code, text, 0)
+	socket.reportError(newConnError("read", err))
+	socket.disconnected(err)
+}
+
+// closeWith sends a close frame with code and text and closes the connection,
+// after waiting up to wait for the peer's close frame if wait is positive.
+func (socket *Socket) closeWith(code int, text string, wait time.Duration) error {
+	conn := socket.conn()
+	if conn == nil {
+		// Never connected, or reconnecting failed and dropped the connection.
+		socket.release()
+		return nil
+	}
+	socket.pongMu.Lock()
+	err := socket.writeControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(closeWriteWait))
+	socket.pongMu.Unlock()
+	if err != nil {
+		socket.log.error("write close:", err)
+	} else if wait > 0 {
+		socket.awaitPeerClose(conn, wait)
+	}
+	conn.Close()
+	socket.release()
+	return err
+}
+
+// awaitPeerClose waits up to timeout for the peer to answer the close frame
+// sent on conn. Normally the receive loop reads the answer and exits; with
+// ManualRecvStart, before StartReceiving, it is read here instead.
+func (socket *Socket) awaitPeerClose(conn connection, timeout time.Duration) {
+	if atomic.LoadInt32(socket.recvPending) == 1 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		socket.running.wait()
+		close(stopped)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		socket.log.warning("No close frame from server within", timeout)
+	}
+}
+
+// release removes the socket from the ActiveSockets count.
+func (socket *Socket) release() {
+	if atomic.CompareAndSwapInt32(socket.active, 1, 0) {
+		atomic.AddInt32(&activeSockets, -1)
+	}
+}
+
+func (socket *Socket) isFatalCloseCode(code int) bool {
+	for _, fatal := range socket.FatalCloseCodes {
+		if code == fatal {
+			return true
+		}
+	}
+	return false
+}
+
+// Close sends a normal closure frame and closes the connection for good. It
+// may be called from within message handlers: handlers run outside
+// receiveMu, the close frame is written without taking sendMu, and the
+// receive loop exits instead of reconnecting once it sees the closed
+// connection. A reconnect loop in progress is aborted, and Close waits for it
+// to return unless called from one of that loop's callbacks.
 func (socket *Socket) Close() {
-	err := socket.close()
-	if socket.OnDisconnected != nil {
-		socket.IsConnected = false
-		socket.OnDisconnected(err, *socket)
+	socket.CloseWithCode(websocket.CloseNormalClosure, "")
+}
+
+// CloseWithCode closes the socket like Close, sending code and reason in the
+// close frame, e.g. websocket.CloseGoingAway. The reason must fit the 123
+// bytes left in a control frame. The error from writing the close frame is
+// returned; the connection is closed regardless.
+func (socket *Socket) CloseWithCode(code int, reason string) error {
+	return socket.shutdown(code, reason, 0)
+}
+
+// CloseGracefully closes the socket like Close but completes the closing
+// handshake: the TCP connection is only closed once the server has answered
+// the close frame, or timeout has passed, so both ends see a normal closure
+// instead of an abnormal one. It must not be called from the socket's
+// callbacks, as the receive loop that reads the answer runs them.
+func (socket *Socket) CloseGracefully(timeout time.Duration) error {
+	return socket.shutdown(websocket.CloseNormalClosure, "", timeout)
+}
+
+// shutdown closes the socket for good, see closeWith for wait.
+func (socket *Socket) shutdown(code int, reason string, wait time.Duration) error {
+	socket.markClosed()
+	err := socket.closeWith(code, reason, wait)
+	socket.reconnect.wait()
+	socket.disconnectedAs(DisconnectNormal, err)
+	socket.traceEvent(TraceEvent{Type: TraceClosed})
+	return err
+}
+
+// CloseWithTimeout closes the socket like Close but returns within timeout
+// even if the close handshake, the TCP teardown or a reconnect callback
+// hangs. In that case the connection is abandoned: the socket is marked
+// closed and disconnected, the rest of the teardown carries on in the
+// background and ErrCloseTimeout is returned.
+func (socket *Socket) CloseWithTimeout(timeout time.Duration) error {
+	socket.markClosed()
+	closed := make(chan struct{})
+	go func() {
+		socket.Close()
+		close(closed)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-closed:
+		return nil
+	case <-timer.C:
+		socket.log.warning("Close did not finish within", timeout, "- abandoning connection")
+		socket.release()
+		return ErrCloseTimeout
+	}
+}
+
+// sleep waits for d and reports false if the socket was closed meanwhile.
+func (socket *Socket) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-socket.done:
+		return false
 	}
 }
+
+func (socket *Socket) isClosed() bool {
+	select {
+	case <-socket.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done returns a channel that is closed once the socket is closed for good
+// via Close. Unlike OnDisconnected it is not affected by transient drops that
+// are followed by a reconnect, so goroutines started from handlers can use it
+// to exit. Use Wait to block until the socket's goroutines have finished.
+func (socket *Socket) Done() <-chan struct{} {
+	return socket.done
+}
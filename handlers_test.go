@@ -0,0 +1,156 @@
+package gowebsocket
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestSetTextMessageHandlerWhileReceiving swaps the handler while the
+// receive loop is dispatching; run with -race.
+func TestSetTextMessageHandlerWhileReceiving(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	first := make(chan string, 100)
+	socket.OnTextMessage = func(message string, socket *Socket) { first <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			socket.SendText("before")
+		}
+	}()
+	second := make(chan string, 1)
+	socket.SetTextMessageHandler(func(message string, socket *Socket) {
+		if message == "after" {
+			second <- message
+		}
+	})
+	<-done
+	socket.SendText("after")
+	select {
+	case <-second:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the new handler was not called")
+	}
+	for len(first) > 0 {
+		if message := <-first; message != "before" {
+			t.Fatalf("the old handler received %q after the swap", message)
+		}
+	}
+}
+
+func TestSetTextMessageHandlerWhileIdle(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.OnTextMessage = func(message string, socket *Socket) {}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	// Let the receive loop block waiting for a frame before swapping.
+	time.Sleep(50 * time.Millisecond)
+
+	received := make(chan string, 1)
+	socket.SetTextMessageHandler(func(message string, socket *Socket) { received <- message })
+	socket.SendText("hello")
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first message after the swap went to the old handler")
+	}
+}
+
+func TestWarnOnMissingHandlers(t *testing.T) {
+	for _, warn := range []bool{false, true} {
+		conn := newMockConn()
+		socket := New("ws://127.0.0.1:1")
+		socket.WarnOnMissingHandlers = warn
+		var output syncBuffer
+		socket.SetLogOutput(&output)
+		var mu sync.Mutex
+		var reported []error
+		socket.OnError = func(err error, socket *Socket) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		}
+		useConn(&socket, conn)
+		conn.inbound <- mockMessage{websocket.TextMessage, []byte("first")}
+		conn.inbound <- mockMessage{websocket.BinaryMessage, []byte("second")}
+		waitUntil(t, "both messages to be read", func() bool { return len(conn.inbound) == 0 })
+		// Give the receive loop time to drop the second message.
+		time.Sleep(20 * time.Millisecond)
+		socket.Close()
+
+		mu.Lock()
+		errs := reported
+		mu.Unlock()
+		warned := strings.Contains(strings.Join(output.lines(), "\n"), "Dropped text message")
+		if !warn {
+			if len(errs) != 0 || warned {
+				t.Fatalf("warned without WarnOnMissingHandlers: %v", errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], ErrNoHandler) {
+			t.Fatalf("OnError got %v, want ErrNoHandler once", errs)
+		}
+		if !warned {
+			t.Fatalf("no warning logged: %q", output.lines())
+		}
+	}
+}
+
+func TestHandlerPanicRecovered(t *testing.T) {
+	conn := newMockConn()
+	socket := New("ws://127.0.0.1:1")
+	received := make(chan string, 2)
+	socket.OnTextMessage = func(message string, socket *Socket) {
+		if message == "boom" {
+			panic("bad message")
+		}
+		received <- message
+	}
+	reported := make(chan error, 1)
+	socket.OnError = func(err error, socket *Socket) {
+		select {
+		case reported <- err:
+		default:
+		}
+	}
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	conn.inbound <- mockMessage{websocket.TextMessage, []byte("boom")}
+	conn.inbound <- mockMessage{websocket.TextMessage, []byte("after")}
+	select {
+	case err := <-reported:
+		var panicErr *CallbackPanicError
+		if !errors.As(err, &panicErr) || panicErr.Callback != "OnTextMessage" || panicErr.Value != "bad message" || len(panicErr.Stack) == 0 {
+			t.Fatalf("OnError got %#v, want a *CallbackPanicError", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic not reported")
+	}
+	select {
+	case message := <-received:
+		if message != "after" {
+			t.Fatalf("received %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message after the panic not delivered")
+	}
+	if !socket.IsConnected() {
+		t.Fatal("a handler panic dropped the connection")
+	}
+}
@@ -0,0 +1,35 @@
+package gowebsocket
+
+import (
+	"encoding/base64"
+	"net/http"
+)
+
+// SetRequestHeader sets the handshake header key to value, replacing any
+// values it had. The key is canonicalized like http.Header.Set does. Call it
+// before connecting.
+func (socket *Socket) SetRequestHeader(key, value string) {
+	socket.requestHeader().Set(key, value)
+}
+
+// AddRequestHeader adds value to the handshake header key, keeping any
+// values it already has.
+func (socket *Socket) AddRequestHeader(key, value string) {
+	socket.requestHeader().Add(key, value)
+}
+
+// SetBasicAuth sets the handshake's Authorization header to use HTTP Basic
+// Authentication with the given credentials, encoded as
+// http.Request.SetBasicAuth does. The credentials are not encrypted, so use
+// it over wss only.
+func (socket *Socket) SetBasicAuth(username, password string) {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	socket.SetRequestHeader("Authorization", "Basic "+auth)
+}
+
+func (socket *Socket) requestHeader() http.Header {
+	if socket.RequestHeader == nil {
+		socket.RequestHeader = http.Header{}
+	}
+	return socket.RequestHeader
+}
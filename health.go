@@ -0,0 +1,53 @@
+package gowebsocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type healthStatus struct {
+	Connected           bool       `json:"connected"`
+	Url                 string     `json:"url"`
+	Reconnects          uint64     `json:"reconnects"`
+	LastConnectedAt     *time.Time `json:"last_connected_at,omitempty"`
+	LastDisconnectedAt  *time.Time `json:"last_disconnected_at,omitempty"`
+	LastDisconnectError string     `json:"last_disconnect_error,omitempty"`
+	MessagesSent        uint64     `json:"messages_sent"`
+	MessagesReceived    uint64     `json:"messages_received"`
+	BytesSent           uint64     `json:"bytes_sent"`
+	BytesReceived       uint64     `json:"bytes_received"`
+}
+
+// HealthHandler returns an http.Handler reporting the socket's state as JSON,
+// suitable for mounting at e.g. /healthz/ws. It responds 200 while connected
+// and 503 otherwise.
+func (socket *Socket) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := socket.Stats()
+		status := healthStatus{
+			Connected:        socket.IsConnected(),
+			Url:              socket.CurrentURL(),
+			Reconnects:       stats.Reconnects,
+			MessagesSent:     stats.MessagesSent,
+			MessagesReceived: stats.MessagesReceived,
+			BytesSent:        stats.BytesSent,
+			BytesReceived:    stats.BytesReceived,
+		}
+		if !stats.LastConnectedAt.IsZero() {
+			status.LastConnectedAt = &stats.LastConnectedAt
+		}
+		if !stats.LastDisconnectedAt.IsZero() {
+			status.LastDisconnectedAt = &stats.LastDisconnectedAt
+		}
+		if stats.LastDisconnectErr != nil {
+			status.LastDisconnectError = stats.LastDisconnectErr.Error()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Connected {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
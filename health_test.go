@@ -0,0 +1,54 @@
+package gowebsocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func getHealth(t *testing.T, socket *Socket) (int, healthStatus) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	socket.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz/ws", nil))
+	var status healthStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, status
+}
+
+func TestHealthHandler(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	received := make(chan struct{}, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- struct{}{} }
+
+	if code, status := getHealth(t, &socket); code != http.StatusServiceUnavailable || status.Connected {
+		t.Fatalf("before connecting: %d %+v", code, status)
+	}
+
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	socket.SendText("abc")
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("echo not received")
+	}
+	code, status := getHealth(t, &socket)
+	if code != http.StatusOK || !status.Connected || status.Url != url || status.LastConnectedAt == nil {
+		t.Fatalf("connected: %d %+v", code, status)
+	}
+	if status.MessagesSent != 1 || status.BytesSent != 3 || status.MessagesReceived != 1 || status.BytesReceived != 3 {
+		t.Fatalf("throughput: %+v", status)
+	}
+
+	socket.Close()
+	code, status = getHealth(t, &socket)
+	if code != http.StatusServiceUnavailable || status.Connected || status.LastDisconnectedAt == nil {
+		t.Fatalf("after Close: %d %+v", code, status)
+	}
+}
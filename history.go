@@ -0,0 +1,122 @@
+package gowebsocket
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// attemptHistorySize bounds the number of records kept by AttemptHistory.
+const attemptHistorySize = 32
+
+// AttemptRecord describes a single connect or reconnect attempt.
+type AttemptRecord struct {
+	Time     time.Time     // When the attempt started
+	Duration time.Duration // How long the dial and handshake took
+	Attempt  int           // 0 for the initial connect, n for the nth reconnect attempt
+	URL      string        // The URL dialed, one record per URL with Urls
+	Err      error         // nil if the attempt succeeded
+
+	// Breakdown of Duration. A phase that did not happen, such as DNS for an
+	// IP address or TLS for ws://, is left zero.
+	DNS          time.Duration
+	Connect      time.Duration // TCP connect
+	TLSHandshake time.Duration
+	Upgrade      time.Duration // From the connection being ready to the handshake response
+}
+
+// dialTimer collects the phase timings of a single dial through
+// httptrace. The hooks may fire from the resolver's and dialer's own
+// goroutines.
+type dialTimer struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dns          time.Duration
+	connectStart time.Time
+	connect      time.Duration
+	tlsStart     time.Time
+	tls          time.Duration
+	ready        time.Time
+}
+
+func (timer *dialTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			timer.mu.Lock()
+			timer.dnsStart = time.Now()
+			timer.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			timer.mu.Lock()
+			timer.dns = time.Since(timer.dnsStart)
+			timer.mu.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			timer.mu.Lock()
+			if timer.connectStart.IsZero() {
+				timer.connectStart = time.Now()
+			}
+			timer.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			timer.mu.Lock()
+			if err == nil {
+				timer.connect = time.Since(timer.connectStart)
+			}
+			timer.mu.Unlock()
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			timer.mu.Lock()
+			timer.ready = time.Now()
+			timer.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			timer.mu.Lock()
+			timer.tlsStart = time.Now()
+			timer.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			timer.mu.Lock()
+			timer.tls = time.Since(timer.tlsStart)
+			timer.ready = time.Now()
+			timer.mu.Unlock()
+		},
+	}
+}
+
+// fill copies the collected timings into record, whose Time and Duration
+// must already be set.
+func (timer *dialTimer) fill(record *AttemptRecord) {
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+	record.DNS = timer.dns
+	record.Connect = timer.connect
+	record.TLSHandshake = timer.tls
+	if !timer.ready.IsZero() {
+		record.Upgrade = record.Time.Add(record.Duration).Sub(timer.ready)
+	}
+}
+
+type attemptHistory struct {
+	mu      sync.Mutex
+	records []AttemptRecord
+}
+
+func (history *attemptHistory) add(record AttemptRecord) {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	if len(history.records) == attemptHistorySize {
+		copy(history.records, history.records[1:])
+		history.records = history.records[:attemptHistorySize-1]
+	}
+	history.records = append(history.records, record)
+}
+
+// AttemptHistory returns the most recent connect and reconnect attempts,
+// oldest first, to help diagnose flapping connections.
+func (socket *Socket) AttemptHistory() []AttemptRecord {
+	socket.history.mu.Lock()
+	defer socket.history.mu.Unlock()
+	return append([]AttemptRecord(nil), socket.history.records...)
+}
@@ -0,0 +1,68 @@
+package gowebsocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// refusingServer drops the first connection straight away, answers the next
+// refusals handshakes with 503 and echoes on the connections after that.
+func refusingServer(t *testing.T, refusals int32) string {
+	var requests int32
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		if n > 1 && n <= 1+refusals {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if n > 1 {
+			echo(conn)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestAttemptHistoryRecordsFlapping(t *testing.T) {
+	socket := New(refusingServer(t, 2))
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	reconnected := make(chan struct{}, 1)
+	socket.OnReconnected = func(socket *Socket) { reconnected <- struct{}{} }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not reconnect")
+	}
+
+	history := socket.AttemptHistory()
+	if len(history) != 4 {
+		t.Fatalf("%d attempts recorded, want 4", len(history))
+	}
+	for i, record := range history {
+		if record.Attempt != i {
+			t.Errorf("record %d is for attempt %d", i, record.Attempt)
+		}
+		if failed := i == 1 || i == 2; (record.Err != nil) != failed {
+			t.Errorf("attempt %d recorded error %v", i, record.Err)
+		}
+		if i > 0 && record.Time.Before(history[i-1].Time) {
+			t.Errorf("attempt %d recorded before the one preceding it", i)
+		}
+	}
+}
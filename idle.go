@@ -0,0 +1,44 @@
+package gowebsocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// startRead sets the read deadline for the next message: Timeout from now,
+// or IdleTimeout if that comes first. The Timeout deadline is remembered so
+// that activity during the read cannot extend past it.
+func (socket *Socket) startRead(conn connection) {
+	now := time.Now()
+	var hard int64
+	if socket.Timeout != 0 {
+		hard = now.Add(socket.Timeout).UnixNano()
+	}
+	atomic.StoreInt64(socket.readDeadline, hard)
+	if deadline := socket.nextReadDeadline(now); !deadline.IsZero() {
+		conn.SetReadDeadline(deadline)
+	}
+}
+
+// touchRead restarts the IdleTimeout window after a ping or pong, so that
+// keepalive traffic keeps an otherwise quiet connection up.
+func (socket *Socket) touchRead(conn connection) {
+	if socket.IdleTimeout > 0 {
+		conn.SetReadDeadline(socket.nextReadDeadline(time.Now()))
+	}
+}
+
+// nextReadDeadline returns the earlier of the read's Timeout deadline and
+// now plus IdleTimeout, or the zero time if neither is set.
+func (socket *Socket) nextReadDeadline(now time.Time) time.Time {
+	var deadline time.Time
+	if hard := atomic.LoadInt64(socket.readDeadline); hard != 0 {
+		deadline = time.Unix(0, hard)
+	}
+	if socket.IdleTimeout > 0 {
+		if idle := now.Add(socket.IdleTimeout); deadline.IsZero() || idle.Before(deadline) {
+			deadline = idle
+		}
+	}
+	return deadline
+}
@@ -0,0 +1,21 @@
+package gowebsocket
+
+// OutboundInterceptor transforms an outbound message, e.g. to sign it,
+// choose how to encode it or record metrics, and returns the message type
+// and payload to send instead. An error aborts the send and is returned to
+// the caller. Interceptors run under the send lock, so they see messages in
+// the order they are written, and must not send on the socket themselves.
+// Messages resent after a reconnect or flushed from the send queue are sent
+// as transformed and not intercepted again.
+type OutboundInterceptor func(messageType int, data []byte) (int, []byte, error)
+
+// intercept runs the OutboundInterceptors over a message; sendMu must be held.
+func (socket *Socket) intercept(messageType int, data []byte) (int, []byte, error) {
+	for _, interceptor := range socket.OutboundInterceptors {
+		var err error
+		if messageType, data, err = interceptor(messageType, data); err != nil {
+			return messageType, data, err
+		}
+	}
+	return messageType, data, nil
+}
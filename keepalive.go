@@ -0,0 +1,43 @@
+package gowebsocket
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// keepAlive pings conn every interval until a ping fails or the socket is
+// closed. A ping still without a pong when the next one is due marks the
+// connection as dead: its read deadline is moved to now, so the receive loop
+// fails with a timeout and takes the usual disconnect and reconnect path,
+// which starts a new keepalive for the new connection.
+//
+// Like SendPing, pings are written with WriteControl rather than under
+// sendMu, so a data write stuck on the dead connection cannot hold them up.
+func (socket *Socket) keepAlive(conn connection, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var pingAt int64
+	for {
+		select {
+		case <-socket.done:
+			return
+		case <-ticker.C:
+		}
+		if pingAt != 0 && atomic.LoadInt64(socket.lastPong) < pingAt {
+			socket.log.warning("No pong within", interval, "- connection is dead")
+			conn.SetReadDeadline(time.Now())
+			return
+		}
+		now := time.Now()
+		pingAt = now.UnixNano()
+		socket.stats.pingSent(now)
+		if err := conn.WriteControl(websocket.PingMessage, nil, now.Add(interval)); err != nil {
+			socket.stats.pingSent(time.Time{})
+			return
+		}
+		socket.stats.outbound.count(websocket.PingMessage)
+		socket.traceEvent(TraceEvent{Type: TracePingSent})
+	}
+}
@@ -0,0 +1,48 @@
+package gowebsocket
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLocalAddr(t *testing.T) {
+	local := net.IPv4(127, 0, 0, 2)
+	// Any address in 127.0.0.0/8 is loopback on Linux, but not everywhere.
+	if probe, err := net.ListenTCP("tcp", &net.TCPAddr{IP: local}); err != nil {
+		t.Skip("127.0.0.2 is not available:", err)
+	} else {
+		probe.Close()
+	}
+
+	remote := make(chan string, 1)
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote <- r.RemoteAddr
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	socket := New("ws" + strings.TrimPrefix(server.URL, "http"))
+	socket.ConnectionOptions.LocalAddr = &net.TCPAddr{IP: local}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	host, _, err := net.SplitHostPort(<-remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !net.ParseIP(host).Equal(local) {
+		t.Fatalf("connection came from %s, want %s", host, local)
+	}
+}
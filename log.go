@@ -0,0 +1,138 @@
+package gowebsocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogFormat selects how lines written to a custom log output are rendered.
+type LogFormat int
+
+const (
+	LogFormatText LogFormat = iota
+	LogFormatJSON
+)
+
+// Logger receives a socket's log lines. Each method takes fmt.Println style
+// arguments, so a *logrus.Logger can be used as is and most other logging
+// packages need only a thin adapter.
+type Logger interface {
+	Trace(v ...interface{})
+	Info(v ...interface{})
+	Warning(v ...interface{})
+	Error(v ...interface{})
+}
+
+// packageLogger is the default Logger. It writes to the package logger, whose
+// level is shared by all sockets and set with EnableLogging.
+type packageLogger struct{}
+
+func (packageLogger) Trace(v ...interface{})   { packageOutput(logger.Trace, v) }
+func (packageLogger) Info(v ...interface{})    { packageOutput(logger.Info, v) }
+func (packageLogger) Warning(v ...interface{}) { packageOutput(logger.Warning, v) }
+func (packageLogger) Error(v ...interface{})   { packageOutput(logger.Error, v) }
+
+// packageOutput writes a line whose file:line points at the socket code that
+// logged it rather than at the logging helpers.
+func packageOutput(std *log.Logger, v []interface{}) {
+	std.Output(5, fmt.Sprintln(v...))
+}
+
+// socketLogger writes to the socket's Logger unless the socket has been given
+// its own output, in which case every level is written there in the chosen
+// format. Every line is tagged with the socket's name.
+type socketLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format LogFormat
+	name   string
+	logger Logger
+}
+
+func (l *socketLogger) println(level string, write func(Logger, ...interface{}), v ...interface{}) {
+	l.mu.Lock()
+	if l.out == nil {
+		logger, name := l.logger, l.name
+		l.mu.Unlock()
+		// Called without mu so that a Logger may use the socket.
+		write(logger, append([]interface{}{"[" + name + "]"}, v...)...)
+		return
+	}
+	defer l.mu.Unlock()
+
+	msg := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+	now := time.Now()
+	switch l.format {
+	case LogFormatJSON:
+		line, _ := json.Marshal(struct {
+			Time  time.Time `json:"time"`
+			Level string    `json:"level"`
+			Name  string    `json:"name"`
+			Msg   string    `json:"msg"`
+		}{now, strings.ToLower(level), l.name, msg})
+		l.out.Write(append(line, '\n'))
+	default:
+		fmt.Fprintf(l.out, "%s: %s [%s] %s\n", level, now.Format("2006/01/02 15:04:05"), l.name, msg)
+	}
+}
+
+func (l *socketLogger) trace(v ...interface{})   { l.println("TRACE", Logger.Trace, v...) }
+func (l *socketLogger) info(v ...interface{})    { l.println("INFO", Logger.Info, v...) }
+func (l *socketLogger) warning(v ...interface{}) { l.println("WARNING", Logger.Warning, v...) }
+func (l *socketLogger) error(v ...interface{})   { l.println("ERROR", Logger.Error, v...) }
+
+// setLogger switches to the socket's Logger field, falling back to the package
+// logger if it is nil.
+func (l *socketLogger) setLogger(logger Logger) {
+	if logger == nil {
+		logger = packageLogger{}
+	}
+	l.mu.Lock()
+	l.logger = logger
+	l.mu.Unlock()
+}
+
+// SetLogOutput redirects this socket's log lines to w regardless of the
+// package log level, bypassing Logger. Passing nil restores the package logger.
+func (socket *Socket) SetLogOutput(w io.Writer) {
+	socket.log.mu.Lock()
+	socket.log.out = w
+	socket.log.mu.Unlock()
+}
+
+// SetLogFormat selects text or JSON lines for output set via SetLogOutput.
+func (socket *Socket) SetLogFormat(format LogFormat) {
+	socket.log.mu.Lock()
+	socket.log.format = format
+	socket.log.mu.Unlock()
+}
+
+// SetName tags the socket's log lines and Stats with name. It defaults to the
+// host of the socket's URL.
+func (socket *Socket) SetName(name string) {
+	socket.log.mu.Lock()
+	socket.log.name = name
+	socket.log.mu.Unlock()
+}
+
+// Name returns the name set with SetName.
+func (socket *Socket) Name() string {
+	socket.log.mu.Lock()
+	defer socket.log.mu.Unlock()
+	return socket.log.name
+}
+
+// hostOf returns the host of rawURL, or rawURL itself if it cannot be parsed.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
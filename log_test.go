@@ -0,0 +1,95 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the socket's goroutines.
+type syncBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(b.buffer.String(), "\n"), "\n")
+}
+
+func TestSetLogFormatJSON(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	var output syncBuffer
+	socket.SetLogOutput(&output)
+	socket.SetLogFormat(LogFormatJSON)
+	received := make(chan struct{})
+	socket.OnTextMessage = func(message string, socket *Socket) { close(received) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	socket.SendText("hello")
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("echo not received")
+	}
+	socket.Close()
+
+	lines := output.lines()
+	if len(lines) < 2 {
+		t.Fatalf("only %d lines logged: %q", len(lines), lines)
+	}
+	for _, line := range lines {
+		var entry struct {
+			Time, Level, Name, Msg string
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line is not JSON: %q", line)
+		}
+		if entry.Time == "" || entry.Level == "" || entry.Msg == "" {
+			t.Fatalf("line lacks fields: %q", line)
+		}
+	}
+}
+
+func TestSetName(t *testing.T) {
+	_, url := startServer(t, echo)
+	for _, test := range []struct {
+		name, want string
+	}{
+		{"", strings.TrimPrefix(url, "ws://")},
+		{"feed", "feed"},
+	} {
+		socket := New(url)
+		if test.name != "" {
+			socket.SetName(test.name)
+		}
+		var output syncBuffer
+		socket.SetLogOutput(&output)
+		if err := socket.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		if name := socket.Stats().Name; name != test.want {
+			t.Errorf("Stats().Name = %q, want %q", name, test.want)
+		}
+		socket.Close()
+
+		// At least "Connected to server" is logged.
+		for _, line := range output.lines() {
+			if !strings.Contains(line, " ["+test.want+"] ") {
+				t.Errorf("line lacks the name %q: %q", test.want, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package gowebsocket
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dropFirst drops the first connection as soon as it is established and
+// keeps later ones open.
+func dropFirst() func(conn *websocket.Conn) {
+	var connections int32
+	return func(conn *websocket.Conn) {
+		if atomic.AddInt32(&connections, 1) == 1 {
+			return
+		}
+		echo(conn)
+	}
+}
+
+func TestManualReconnect(t *testing.T) {
+	_, url := startServer(t, dropFirst())
+	socket := New(url)
+	socket.ManualReconnect = true
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	disconnected := make(chan struct{}, 1)
+	socket.OnDisconnected = func(err error, socket *Socket) { disconnected <- struct{}{} }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lost connection was not reported")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if state := socket.State(); state != StateDisconnected {
+		t.Fatalf("State = %v, want disconnected without reconnecting", state)
+	}
+	select {
+	case <-socket.Done():
+		t.Fatal("ManualReconnect closed the socket for good")
+	default:
+	}
+
+	if err := socket.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if !socket.IsConnected() {
+		t.Fatal("not connected after Reconnect")
+	}
+}
+
+func TestNegativeTimesClosesForGood(t *testing.T) {
+	_, url := startServer(t, dropFirst())
+	socket := New(url)
+	socket.ReconnectionOptions.Times = -1
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	select {
+	case <-socket.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("socket not closed after the connection was lost")
+	}
+	socket.Reconnect()
+	if socket.IsConnected() {
+		t.Fatal("reconnected with reconnection disabled")
+	}
+}
+
+func TestZeroTimesRetriesUntilConnected(t *testing.T) {
+	socket := New(refusingServer(t, 5))
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	var attempts int32
+	socket.OnReconnecting = func(attempt int, socket *Socket) { atomic.StoreInt32(&attempts, int32(attempt)) }
+	reconnected := make(chan struct{})
+	socket.OnReconnected = func(socket *Socket) { close(reconnected) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not reconnect")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 6 {
+		t.Fatalf("reconnected on attempt %d, want 6", n)
+	}
+}
+
+func TestPositiveTimesGivesUp(t *testing.T) {
+	socket := New(refusingServer(t, 1000))
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	socket.ReconnectionOptions.Times = 3
+	var attempts int32
+	socket.OnReconnecting = func(attempt int, socket *Socket) { atomic.AddInt32(&attempts, 1) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	waitUntil(t, "giving up", func() bool {
+		return atomic.LoadInt32(&attempts) == 3 && socket.State() == StateDisconnected
+	})
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Fatalf("%d attempts, want 3", n)
+	}
+	if socket.IsConnected() {
+		t.Fatal("connected after giving up")
+	}
+	select {
+	case <-socket.Done():
+		t.Fatal("giving up closed the socket for good")
+	default:
+	}
+}
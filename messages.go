@@ -0,0 +1,64 @@
+package gowebsocket
+
+import "sync"
+
+// messagesBufferSize bounds how many received messages Messages buffers
+// before the read loop waits for the consumer.
+const messagesBufferSize = 256
+
+// messageChannel is the channel behind Messages. mu keeps deliveries and the
+// final close from overlapping.
+type messageChannel struct {
+	once   sync.Once
+	mu     sync.Mutex
+	ch     chan Message
+	sizes  *bufferedSizes
+	closed bool
+}
+
+// Messages returns a channel receiving every text and binary message, as an
+// alternative to callbacks that works with select. Once it has been called
+// the channel takes precedence: OnTextMessage, OnBinaryMessage,
+// OnJSONMessage, OnMessageReader and OnBatch are no longer called. Up to 256
+// messages are buffered; beyond that the read loop waits for the consumer,
+// which also holds up pings and other control frames. The channel is closed
+// once the socket is closed for good. Call it before connecting so that no
+// message is missed; every call returns the same channel.
+func (socket *Socket) Messages() <-chan Message {
+	messages := socket.messages
+	messages.once.Do(func() {
+		messages.mu.Lock()
+		messages.ch = make(chan Message, messagesBufferSize)
+		messages.sizes = newBufferedSizes(messagesBufferSize)
+		messages.mu.Unlock()
+		go func() {
+			<-socket.done
+			messages.mu.Lock()
+			messages.closed = true
+			close(messages.ch)
+			messages.mu.Unlock()
+		}()
+	})
+	return messages.ch
+}
+
+func (messages *messageChannel) enabled() bool {
+	messages.mu.Lock()
+	defer messages.mu.Unlock()
+	return messages.ch != nil
+}
+
+// deliver queues message for Messages. It blocks while the channel is full,
+// unless done is closed.
+func (messages *messageChannel) deliver(message Message, done <-chan struct{}) {
+	messages.mu.Lock()
+	defer messages.mu.Unlock()
+	if messages.closed {
+		return
+	}
+	select {
+	case messages.ch <- message:
+		messages.sizes.add(len(message.Data))
+	case <-done:
+	}
+}
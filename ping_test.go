@@ -0,0 +1,170 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPingReceivedBytes(t *testing.T) {
+	payload := []byte{0xff, 0x00}
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.WriteControl(websocket.PingMessage, payload, time.Now().Add(time.Second))
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	received := make(chan []byte, 1)
+	socket.OnPingReceivedBytes = func(data []byte, socket *Socket) { received <- data }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("OnPingReceivedBytes got %x, want %x", data, payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ping not received")
+	}
+}
+
+func TestPingNotHeldUpBySends(t *testing.T) {
+	pinged := make(chan []byte, 1)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.SetPingHandler(func(appData string) error {
+			pinged <- []byte(appData)
+			return nil
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	socket := New(url)
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	// A message streamed through SendWriter holds the send lock until it
+	// is closed, so the data sends queue up behind it.
+	writer, err := socket.SendWriter(websocket.BinaryMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(make([]byte, 256<<10))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			socket.SendBinary(make([]byte, 256<<10))
+		}()
+	}
+	defer func() {
+		writer.Close()
+		wg.Wait()
+	}()
+
+	const wait = time.Second
+	if err := socket.SendPing([]byte("ping"), time.Now().Add(wait)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-pinged:
+		if string(data) != "ping" {
+			t.Fatalf("server got ping %q", data)
+		}
+	case <-time.After(wait):
+		t.Fatal("ping did not reach the server within its deadline")
+	}
+}
+
+func TestPongSentBeforeClose(t *testing.T) {
+	pongFirst := make(chan bool, 1)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		var ponged bool
+		conn.SetPongHandler(func(string) error {
+			ponged = true
+			return nil
+		})
+		conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if _, ok := err.(*websocket.CloseError); ok {
+					pongFirst <- ponged
+				}
+				return
+			}
+		}
+	})
+	socket := New(url)
+	// Close as soon as the ping arrives, racing the automatic pong.
+	socket.OnPingReceived = func(data string, socket *Socket) { go socket.Close() }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case ponged := <-pongFirst:
+		if !ponged {
+			t.Fatal("close frame arrived before the pong")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server got no close frame")
+	}
+}
+
+func TestIdleTimeoutKeptAliveByPings(t *testing.T) {
+	stopPinging := make(chan struct{})
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		// Read, so the client's pongs are consumed, until it goes away.
+		gone := make(chan struct{})
+		go func() {
+			conn.ReadMessage()
+			close(gone)
+		}()
+		for {
+			select {
+			case <-ticker.C:
+				if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)) != nil {
+					return
+				}
+			case <-stopPinging:
+				<-gone
+				return
+			case <-gone:
+				return
+			}
+		}
+	})
+	socket := New(url)
+	socket.IdleTimeout = 100 * time.Millisecond
+	socket.ReconnectionOptions.Times = -1
+	var disconnects int32
+	socket.OnDisconnected = func(err error, socket *Socket) { atomic.AddInt32(&disconnects, 1) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	// Several IdleTimeout windows pass with nothing but pings.
+	time.Sleep(500 * time.Millisecond)
+	if n := atomic.LoadInt32(&disconnects); n != 0 || !socket.IsConnected() {
+		t.Fatal("dropped while the server was pinging")
+	}
+
+	close(stopPinging)
+	waitUntil(t, "the idle connection to drop", func() bool { return atomic.LoadInt32(&disconnects) == 1 })
+	if n := socket.Stats().Disconnects[DisconnectTimeout]; n != 1 {
+		t.Fatalf("%d timeout disconnects, want 1", n)
+	}
+}
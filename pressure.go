@@ -0,0 +1,31 @@
+package gowebsocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// writeStallWindow is how long a single write may block before
+// WritePressure reports full pressure.
+const writeStallWindow = 5 * time.Second
+
+// WritePressure estimates from 0 to 1 how backed up the outbound path is,
+// so that a slow or stuck peer can be noticed before writes time out.
+// Gorilla does not expose how much of its write buffer is in use, so this
+// is the larger of how long the write in progress has been blocked,
+// relative to writeStallWindow, and how full the SendAsync queue is.
+func (socket *Socket) WritePressure() float64 {
+	var stalled float64
+	if started := atomic.LoadInt64(socket.writeStarted); started != 0 {
+		stalled = float64(time.Since(time.Unix(0, started))) / float64(writeStallWindow)
+	}
+	queued := float64(len(socket.async)) / float64(asyncQueueSize)
+	pressure := stalled
+	if queued > pressure {
+		pressure = queued
+	}
+	if pressure > 1 {
+		pressure = 1
+	}
+	return pressure
+}
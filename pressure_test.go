@@ -0,0 +1,46 @@
+package gowebsocket
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWritePressureSlowReader(t *testing.T) {
+	release := make(chan struct{})
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		<-release
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	socket := New(url)
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	if pressure := socket.WritePressure(); pressure != 0 {
+		t.Fatalf("pressure on an idle connection = %v, want 0", pressure)
+	}
+
+	// Far more than the socket buffers hold, so the write blocks until the
+	// server reads. Nothing is queued, so only the stalled write counts.
+	sent := make(chan error, 1)
+	go func() { sent <- socket.SendBinary(make([]byte, 16<<20)) }()
+	waitUntil(t, "pressure to rise", func() bool { return socket.WritePressure() > 0.01 })
+	select {
+	case err := <-sent:
+		t.Fatalf("write finished while the server was not reading: %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if pressure := socket.WritePressure(); pressure != 0 {
+		t.Fatalf("pressure once the write finished = %v, want 0", pressure)
+	}
+}
@@ -0,0 +1,100 @@
+package gowebsocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// rttSmoothing is the weight given to a new RTT sample in the moving
+// average reported by Stats().RTT.
+const rttSmoothing = 0.25
+
+// pingSent records when SendPing last wrote a ping, for measuring RTT when
+// the matching pong arrives. A zero time clears it.
+func (stats *socketStats) pingSent(now time.Time) {
+	var at int64
+	if !now.IsZero() {
+		at = now.UnixNano()
+	}
+	atomic.StoreInt64(&stats.lastPingAt, at)
+}
+
+// pongReceived turns the time since the last ping into an RTT sample. Pongs
+// without an outstanding ping are ignored.
+func (stats *socketStats) pongReceived(now time.Time) {
+	sent := atomic.SwapInt64(&stats.lastPingAt, 0)
+	if sent == 0 {
+		return
+	}
+	sample := now.Sub(time.Unix(0, sent))
+	stats.mu.Lock()
+	if stats.rtt == 0 {
+		stats.rtt = sample
+	} else {
+		stats.rtt += time.Duration(rttSmoothing * float64(sample-stats.rtt))
+	}
+	stats.mu.Unlock()
+}
+
+func (stats *socketStats) errorReported(now time.Time, window time.Duration) {
+	stats.mu.Lock()
+	stats.errors = append(stats.pruneErrors(now, window), now)
+	stats.mu.Unlock()
+}
+
+// pruneErrors drops errors older than window; stats.mu must be held.
+func (stats *socketStats) pruneErrors(now time.Time, window time.Duration) []time.Time {
+	if window <= 0 {
+		window = defaultSuccessRateWindow
+	}
+	i := 0
+	for i < len(stats.errors) && now.Sub(stats.errors[i]) > window {
+		i++
+	}
+	stats.errors = stats.errors[i:]
+	return stats.errors
+}
+
+// QualityScore rates the connection from 0 (unusable) to 100 for display
+// as a signal-strength style indicator. It is 0 while disconnected and
+// otherwise starts at 100, minus:
+//
+//   - up to 40 for RTT, scaling linearly from 100ms to 1s. RTT is measured
+//     from SendPing to the next pong, so it only counts once pings are sent.
+//   - 3 per reconnect attempt, up to 30.
+//   - 3 per read or write error, up to 30.
+//
+// Attempts and errors count within ReconnectionOptions.SuccessRateWindow.
+func (socket *Socket) QualityScore() int {
+	if !socket.IsConnected() {
+		return 0
+	}
+	stats := socket.stats
+	window := socket.reconnectionOptions().SuccessRateWindow
+	now := time.Now()
+
+	stats.mu.Lock()
+	rtt := stats.rtt
+	attempts := len(stats.pruneReconnectAttempts(now, window))
+	errors := len(stats.pruneErrors(now, window))
+	stats.mu.Unlock()
+
+	score := 100.0
+	if rtt > 100*time.Millisecond {
+		fraction := float64(rtt-100*time.Millisecond) / float64(900*time.Millisecond)
+		if fraction > 1 {
+			fraction = 1
+		}
+		score -= 40 * fraction
+	}
+	score -= 3 * float64(minInt(attempts, 10))
+	score -= 3 * float64(minInt(errors, 10))
+	return int(score + 0.5)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,69 @@
+package gowebsocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQualityScore(t *testing.T) {
+	socket := New("ws://127.0.0.1:1")
+	if score := socket.QualityScore(); score != 0 {
+		t.Fatalf("score while disconnected = %d, want 0", score)
+	}
+	conn := newMockConn()
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	// A fast pong and no trouble.
+	now := time.Now()
+	socket.stats.pingSent(now)
+	socket.stats.pongReceived(now.Add(10 * time.Millisecond))
+	good := socket.QualityScore()
+	if good != 100 {
+		t.Fatalf("score on a good connection = %d, want 100", good)
+	}
+
+	// A slow pong, reconnect attempts and errors each cost points.
+	score := good
+	worse := func(what string, degrade func()) {
+		t.Helper()
+		degrade()
+		next := socket.QualityScore()
+		if next >= score {
+			t.Fatalf("score went from %d to %d after %s", score, next, what)
+		}
+		score = next
+	}
+	worse("a slow pong", func() {
+		now := time.Now()
+		socket.stats.pingSent(now)
+		socket.stats.pongReceived(now.Add(3 * time.Second))
+	})
+	worse("failed reconnect attempts", func() {
+		socket.stats.reconnectAttempted(false, 0)
+		socket.stats.reconnectAttempted(false, 0)
+	})
+	worse("errors", func() {
+		for i := 0; i < 3; i++ {
+			socket.stats.errorReported(time.Now(), 0)
+		}
+	})
+	if score < 0 || score > 100 {
+		t.Fatalf("score %d out of range", score)
+	}
+
+	// Fast pongs bring the smoothed RTT, and the score, back up.
+	for i := 0; i < 20; i++ {
+		now := time.Now()
+		socket.stats.pingSent(now)
+		socket.stats.pongReceived(now.Add(10 * time.Millisecond))
+	}
+	if recovered := socket.QualityScore(); recovered <= score {
+		t.Fatalf("score went from %d to %d after fast pongs", score, recovered)
+	}
+
+	socket.Close()
+	if score := socket.QualityScore(); score != 0 {
+		t.Fatalf("score after Close = %d, want 0", score)
+	}
+}
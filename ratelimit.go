@@ -0,0 +1,37 @@
+package gowebsocket
+
+import "time"
+
+// inboundRate is a token bucket refilled at MaxInboundRate tokens per second
+// and holding at most one second's worth, so short bursts within the rate
+// are tolerated. It is only used from the receive goroutine.
+type inboundRate struct {
+	tokens float64
+	last   time.Time
+}
+
+// exceeded takes a token for a message received at now and reports whether
+// none was left. A rate of zero or less disables the check.
+func (bucket *inboundRate) exceeded(rate float64, now time.Time) bool {
+	if rate <= 0 {
+		return false
+	}
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	if bucket.last.IsZero() {
+		bucket.tokens = burst
+	} else {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+		if bucket.tokens > burst {
+			bucket.tokens = burst
+		}
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return true
+	}
+	bucket.tokens--
+	return false
+}
@@ -0,0 +1,69 @@
+package gowebsocket
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMaxInboundRateFlood(t *testing.T) {
+	closeCode := make(chan int, 1)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		go func() {
+			for i := 0; i < 100; i++ {
+				if conn.WriteMessage(websocket.TextMessage, []byte("flood")) != nil {
+					return
+				}
+			}
+		}()
+		_, _, err := conn.ReadMessage()
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			closeCode <- closeErr.Code
+		}
+	})
+	socket := New(url)
+	socket.MaxInboundRate = 10
+	reported := make(chan error, 1)
+	socket.OnError = func(err error, socket *Socket) {
+		select {
+		case reported <- err:
+		default:
+		}
+	}
+	disconnected := make(chan error, 1)
+	socket.OnDisconnected = func(err error, socket *Socket) { disconnected <- err }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	select {
+	case code := <-closeCode:
+		if code != websocket.ClosePolicyViolation {
+			t.Fatalf("server got close code %d, want %d", code, websocket.ClosePolicyViolation)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server got no close frame")
+	}
+	select {
+	case err := <-reported:
+		if !errors.Is(err, ErrInboundRateExceeded) {
+			t.Fatalf("OnError got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnError not called")
+	}
+	select {
+	case err := <-disconnected:
+		if err != ErrInboundRateExceeded {
+			t.Fatalf("OnDisconnected got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnDisconnected not called")
+	}
+	if state := socket.State(); state != StateClosed {
+		t.Fatalf("state is %v, want StateClosed", state)
+	}
+}
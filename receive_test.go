@@ -0,0 +1,116 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMessageReader(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.BinaryMessage, []byte("first message"))
+		conn.WriteMessage(websocket.TextMessage, []byte("second"))
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	received := make(chan string, 2)
+	socket.OnMessageReader = func(messageType int, reader io.Reader, socket *Socket) {
+		if messageType == websocket.BinaryMessage {
+			// Read only part of it; the rest must not leak into the next one.
+			prefix := make([]byte, 5)
+			io.ReadFull(reader, prefix)
+			received <- string(prefix)
+			return
+		}
+		data, _ := ioutil.ReadAll(reader)
+		received <- string(data)
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("received %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q not received", want)
+		}
+	}
+}
+
+// readConn is a connection that yields the same message count times and
+// then fails, for benchmarking the receive path without a network. The
+// methods the receive loop does not use are left to the nil embedded
+// connection.
+type readConn struct {
+	connection
+	messageType int
+	data        []byte
+	count       int
+	reader      bytes.Reader
+	ping, pong  func(appData string) error
+	close       func(code int, text string) error
+}
+
+func (conn *readConn) NextReader() (int, io.Reader, error) {
+	if conn.count == 0 {
+		return 0, nil, io.EOF
+	}
+	conn.count--
+	conn.reader.Reset(conn.data)
+	return conn.messageType, &conn.reader, nil
+}
+
+func (conn *readConn) SetReadDeadline(time.Time) error                     { return nil }
+func (conn *readConn) PingHandler() func(appData string) error             { return conn.ping }
+func (conn *readConn) SetPingHandler(h func(appData string) error)         { conn.ping = h }
+func (conn *readConn) PongHandler() func(appData string) error             { return conn.pong }
+func (conn *readConn) SetPongHandler(h func(appData string) error)         { conn.pong = h }
+func (conn *readConn) CloseHandler() func(code int, text string) error     { return conn.close }
+func (conn *readConn) SetCloseHandler(h func(code int, text string) error) { conn.close = h }
+func (conn *readConn) Close() error                                        { return nil }
+
+// benchmarkReceive runs b.N binary messages of 4 KiB through the receive
+// loop of a socket whose handlers, set up by configure, call received with
+// the number of messages they were given.
+func benchmarkReceive(b *testing.B, configure func(socket *Socket, received func(n int))) {
+	var count int64
+	finished := make(chan struct{})
+	received := func(n int) {
+		if atomic.AddInt64(&count, int64(n)) == int64(b.N) {
+			close(finished)
+		}
+	}
+	socket := New("ws://127.0.0.1:1")
+	socket.ReconnectionOptions.Times = -1
+	socket.Conn = &readConn{messageType: websocket.BinaryMessage, data: make([]byte, 4096), count: b.N}
+	configure(&socket, received)
+	b.ReportAllocs()
+	b.ResetTimer()
+	socket.start(nil)
+	<-finished
+}
+
+func BenchmarkReceiveBytes(b *testing.B) {
+	benchmarkReceive(b, func(socket *Socket, received func(int)) {
+		socket.OnBinaryMessage = func(data []byte, socket *Socket) { received(1) }
+	})
+}
+
+func BenchmarkReceiveReader(b *testing.B) {
+	benchmarkReceive(b, func(socket *Socket, received func(int)) {
+		var header [16]byte
+		socket.OnMessageReader = func(messageType int, reader io.Reader, socket *Socket) {
+			io.ReadFull(reader, header[:])
+			received(1)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package gowebsocket
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reconnectLoop lets Close wait for a running Reconnect to return.
+type reconnectLoop struct {
+	mu         sync.Mutex
+	exited     chan struct{} // Closed when the running loop returns, nil if none is running
+	inCallback int32         // Set while the loop is running a user callback
+}
+
+// begin marks a loop as running and returns the channel to pass to end.
+func (loop *reconnectLoop) begin() chan struct{} {
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+	loop.exited = make(chan struct{})
+	return loop.exited
+}
+
+// end marks the loop whose channel begin returned as exited. The next loop
+// may have begun while this one was finishing; its channel is left alone.
+func (loop *reconnectLoop) end(exited chan struct{}) {
+	loop.mu.Lock()
+	close(exited)
+	if loop.exited == exited {
+		loop.exited = nil
+	}
+	loop.mu.Unlock()
+}
+
+// callback runs f on behalf of the loop, marking it so that a Close from
+// within f does not wait on the loop that is calling it.
+func (loop *reconnectLoop) callback(f func()) {
+	atomic.StoreInt32(&loop.inCallback, 1)
+	defer atomic.StoreInt32(&loop.inCallback, 0)
+	f()
+}
+
+// wait blocks until the running loop, if any, has returned. It returns at
+// once when called from one of the loop's callbacks; the loop then stops as
+// soon as that callback returns.
+func (loop *reconnectLoop) wait() {
+	if atomic.LoadInt32(&loop.inCallback) == 1 {
+		return
+	}
+	loop.mu.Lock()
+	exited := loop.exited
+	loop.mu.Unlock()
+	if exited != nil {
+		<-exited
+	}
+}
+
+// recoverConnection replaces a connection that a write found broken. With
+// ManualReconnect it only closes it, so that the receive loop stops.
+func (socket *Socket) recoverConnection() {
+	if !socket.ManualReconnect {
+		socket.Reconnect()
+	} else if conn := socket.conn(); conn != nil {
+		conn.Close()
+	}
+}
+
+// closedContext returns a context derived from parent that is also
+// cancelled when the socket is closed, so an in-flight dial is abandoned.
+func (socket *Socket) closedContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-socket.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// reconnectCallback runs f, marking it as a callback of the reconnect loop
+// when attempt shows doConnect was called from there.
+func (socket *Socket) reconnectCallback(attempt int, f func()) {
+	if attempt == 0 {
+		f()
+		return
+	}
+	socket.reconnect.callback(f)
+}
+
+// outOfTime reports whether waiting another wait before the next attempt
+// would take a reconnect started at started past MaxElapsedTime.
+func (options ReconnectionOptions) outOfTime(started time.Time, wait time.Duration) bool {
+	return options.MaxElapsedTime > 0 && time.Since(started)+wait >= options.MaxElapsedTime
+}
+
+// attemptContext bounds a reconnect attempt's dial by what is left of
+// MaxElapsedTime.
+func (options ReconnectionOptions) attemptContext(ctx context.Context, started time.Time) (context.Context, context.CancelFunc) {
+	if options.MaxElapsedTime <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, started.Add(options.MaxElapsedTime))
+}
+
+// delay returns how long to wait before the given reconnect attempt,
+// counting from 1.
+func (options ReconnectionOptions) delay(attempt int) time.Duration {
+	delay := options.Interval
+	if options.Multiplier > 1 {
+		grown := float64(options.Interval) * math.Pow(options.Multiplier, float64(attempt-1))
+		delay = time.Duration(math.MaxInt64)
+		if grown < math.MaxInt64 {
+			delay = time.Duration(grown)
+		}
+	}
+	if options.MaxInterval > 0 && delay > options.MaxInterval {
+		delay = options.MaxInterval
+	}
+	if options.Jitter && delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	return delay
+}
@@ -0,0 +1,368 @@
+package gowebsocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectRebindsHandlers(t *testing.T) {
+	var connections int32
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		if atomic.AddInt32(&connections, 1) == 1 {
+			// Drop the first connection once the client has said hello.
+			conn.ReadMessage()
+			return
+		}
+		conn.WriteMessage(websocket.PingMessage, []byte("ping"))
+		echo(conn)
+	})
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	reconnected := make(chan struct{})
+	socket.OnReconnected = func(socket *Socket) { close(reconnected) }
+	pinged := make(chan string, 1)
+	socket.OnPingReceived = func(data string, socket *Socket) { pinged <- data }
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	socket.SendText("hello")
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not reconnect")
+	}
+	if err := socket.SendText("again"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-pinged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ping handler not bound to the new connection")
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no receive loop on the new connection")
+	}
+}
+
+// TestSendWhileReconnecting has senders race the reconnects of a server
+// that keeps dropping the connection; run with -race.
+func TestSendWhileReconnecting(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		for i := 0; i < 5; i++ {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	stop := time.Now().Add(300 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(stop) {
+				socket.SendText("hello")
+				socket.SendPing(nil, time.Now().Add(time.Second))
+				socket.Subprotocol()
+				socket.TLSConnectionState()
+			}
+		}()
+	}
+	wg.Wait()
+	if socket.Stats().Reconnects == 0 {
+		t.Fatal("the server never dropped the connection")
+	}
+}
+
+// TestSetReconnectionOptionsWhileReconnecting changes the options while the
+// server keeps dropping the connection. Run it with -race.
+func TestSetReconnectionOptionsWhileReconnecting(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {})
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	var reconnects int32
+	socket.OnReconnected = func(socket *Socket) { atomic.AddInt32(&reconnects, 1) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			socket.SetReconnectionOptions(ReconnectionOptions{
+				Interval:   time.Duration(1+i%3) * time.Millisecond,
+				Multiplier: 1.5,
+			})
+		}
+	}()
+	waitUntil(t, "no reconnects while the options changed", func() bool {
+		return atomic.LoadInt32(&reconnects) >= 5
+	})
+	close(stop)
+	<-stopped
+}
+
+// TestCloseDuringReconnect closes the socket while the reconnect loop is
+// dialing and while it is waiting between attempts; run with -race.
+func TestCloseDuringReconnect(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		interval time.Duration
+		hang     bool
+	}{
+		{"dialing", time.Millisecond, true},
+		{"waiting", time.Hour, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int32
+			release := make(chan struct{})
+			var upgrader websocket.Upgrader
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) > 1 {
+					if test.hang {
+						<-release
+					}
+					http.Error(w, "down", http.StatusServiceUnavailable)
+					return
+				}
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				// Drop the first connection straight away.
+				conn.Close()
+			}))
+			defer server.Close()
+			defer close(release)
+
+			socket := New("ws" + strings.TrimPrefix(server.URL, "http"))
+			socket.ReconnectionOptions.Interval = test.interval
+			socket.ReconnectionOptions.MaxInterval = test.interval
+			var attempts int32
+			socket.OnReconnecting = func(attempt int, socket *Socket) { atomic.AddInt32(&attempts, 1) }
+			if err := socket.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			if test.hang {
+				waitUntil(t, "a reconnect attempt", func() bool { return atomic.LoadInt32(&requests) > 1 })
+			} else {
+				waitUntil(t, "reconnecting", func() bool { return socket.State() == StateReconnecting })
+			}
+
+			closed := make(chan struct{})
+			go func() {
+				socket.Close()
+				close(closed)
+			}()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Close did not return")
+			}
+			socket.reconnect.mu.Lock()
+			running := socket.reconnect.exited != nil
+			socket.reconnect.mu.Unlock()
+			if running {
+				t.Fatal("reconnect loop still running after Close")
+			}
+			waited := make(chan struct{})
+			go func() {
+				socket.Wait()
+				close(waited)
+			}()
+			select {
+			case <-waited:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Wait did not return after Close")
+			}
+			before := atomic.LoadInt32(&attempts)
+			time.Sleep(50 * time.Millisecond)
+			if after := atomic.LoadInt32(&attempts); after != before {
+				t.Fatalf("%d reconnect attempts after Close", after-before)
+			}
+		})
+	}
+}
+
+// TestReconnectIndependentSockets kills one socket's server for good and
+// checks that a second socket, on another server, still reconnects while
+// the first keeps trying.
+func TestReconnectIndependentSockets(t *testing.T) {
+	kill := make(chan struct{})
+	deadServer, deadURL := startServer(t, func(conn *websocket.Conn) { <-kill })
+	_, liveURL := startServer(t, dropFirst())
+
+	dead := New(deadURL)
+	dead.ReconnectionOptions.Interval = time.Millisecond
+	if err := dead.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer dead.Close()
+	deadServer.Close()
+	close(kill)
+	waitUntil(t, "the first socket to reconnect", func() bool { return dead.State() == StateReconnecting })
+
+	live := New(liveURL)
+	live.ReconnectionOptions.Interval = time.Millisecond
+	reconnected := make(chan struct{})
+	live.OnReconnected = func(socket *Socket) { close(reconnected) }
+	if err := live.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second socket did not reconnect")
+	}
+	if state := dead.State(); state != StateReconnecting {
+		t.Fatalf("first socket is %v, want StateReconnecting", state)
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	options := ReconnectionOptions{
+		Interval:    100 * time.Millisecond,
+		Multiplier:  2,
+		MaxInterval: time.Second,
+	}
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, delay := range want {
+		if got := options.delay(i + 1); got != delay {
+			t.Errorf("delay(%d) = %v, want %v", i+1, got, delay)
+		}
+	}
+	if got := options.delay(1000); got != time.Second {
+		t.Errorf("delay(1000) = %v, want MaxInterval", got)
+	}
+
+	options.MaxInterval = 0
+	if got := options.delay(1000); got <= 0 {
+		t.Errorf("uncapped delay(1000) = %v, want it to saturate instead of overflowing", got)
+	}
+
+	options = ReconnectionOptions{Interval: 100 * time.Millisecond}
+	if got := options.delay(5); got != 100*time.Millisecond {
+		t.Errorf("delay(5) without Multiplier = %v, want Interval", got)
+	}
+
+	plain := ReconnectionOptions{Interval: 100 * time.Millisecond, Multiplier: 2, MaxInterval: time.Second}
+	options = plain
+	options.Jitter = true
+	for attempt := 1; attempt <= 10; attempt++ {
+		full := plain.delay(attempt)
+		if got := options.delay(attempt); got < full/2 || got > full {
+			t.Errorf("jittered delay(%d) = %v, want between %v and %v", attempt, got, full/2, full)
+		}
+	}
+}
+
+func TestReconnectServerStaysDown(t *testing.T) {
+	kill := make(chan struct{})
+	server, url := startServer(t, func(conn *websocket.Conn) { <-kill })
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	socket.ReconnectionOptions.Times = 2
+	var attempts int32
+	socket.OnReconnecting = func(attempt int, socket *Socket) { atomic.AddInt32(&attempts, 1) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	server.Close()
+	close(kill)
+
+	// The automatic reconnect gives up after Times attempts.
+	waitUntil(t, "giving up", func() bool {
+		return atomic.LoadInt32(&attempts) == 2 && socket.State() == StateDisconnected
+	})
+	if socket.IsConnected() {
+		t.Fatal("connected with the server down")
+	}
+	if err := socket.Reconnect(); err == nil {
+		t.Fatal("Reconnect succeeded with the server down")
+	}
+	if socket.IsConnected() {
+		t.Fatal("connected after a failed Reconnect")
+	}
+	if err := socket.SendText("hello"); err != ErrNotConnected {
+		t.Fatalf("SendText = %v, want ErrNotConnected", err)
+	}
+}
+
+// TestDisconnectedOncePerConnection drops two connections with a close
+// frame, which both the close handler and the failed read report.
+func TestDisconnectedOncePerConnection(t *testing.T) {
+	var connections int32
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		if atomic.AddInt32(&connections, 1) > 2 {
+			echo(conn)
+			return
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "restart"))
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	var mu sync.Mutex
+	var lost []error
+	socket.OnDisconnected = func(err error, socket *Socket) {
+		mu.Lock()
+		lost = append(lost, err)
+		mu.Unlock()
+	}
+	var reconnects int32
+	socket.OnReconnected = func(socket *Socket) { atomic.AddInt32(&reconnects, 1) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	waitUntil(t, "two reconnects", func() bool { return atomic.LoadInt32(&reconnects) == 2 })
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lost) != 2 {
+		t.Fatalf("OnDisconnected called %d times for 2 lost connections: %v", len(lost), lost)
+	}
+	for _, err := range lost {
+		if closeErr, ok := err.(*CloseError); !ok || closeErr.Code != websocket.CloseGoingAway {
+			t.Fatalf("OnDisconnected got %v, want the server's close", err)
+		}
+	}
+}
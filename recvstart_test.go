@@ -0,0 +1,39 @@
+package gowebsocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestManualRecvStart(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte("welcome"))
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	socket.ManualRecvStart = true
+	received := make(chan string, 1)
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	// Set after Connect, so nothing may have been read yet.
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	select {
+	case message := <-received:
+		t.Fatalf("%q delivered before StartReceiving", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	socket.StartReceiving()
+	select {
+	case message := <-received:
+		if message != "welcome" {
+			t.Fatalf("received %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing delivered after StartReceiving")
+	}
+}
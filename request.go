@@ -0,0 +1,212 @@
+package gowebsocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrRequestCancelled is returned by PendingRequest.Wait after Cancel.
+var ErrRequestCancelled = errors.New("gowebsocket: request cancelled")
+
+// ErrRequestInterrupted is returned by Request and PendingRequest.Wait when
+// the connection is lost before the reply arrives, see
+// RetryRequestsOnReconnect.
+var ErrRequestInterrupted = errors.New("gowebsocket: connection lost before the reply")
+
+type pendingRequest struct {
+	match  func(json.RawMessage) bool
+	data   []byte // The request as sent, for RetryRequestsOnReconnect
+	sent   bool   // Written; guarded by pendingRequests.mu
+	retry  bool   // Written on a connection since lost; guarded by pendingRequests.mu
+	reply  chan json.RawMessage
+	failed chan error
+}
+
+// pendingRequests holds the matchers of the Request calls awaiting a reply,
+// in the order they were made.
+type pendingRequests struct {
+	mu       sync.Mutex
+	requests []*pendingRequest
+}
+
+func (pending *pendingRequests) add(match func(json.RawMessage) bool, data []byte) *pendingRequest {
+	request := &pendingRequest{
+		match:  match,
+		data:   data,
+		reply:  make(chan json.RawMessage, 1),
+		failed: make(chan error, 1),
+	}
+	pending.mu.Lock()
+	pending.requests = append(pending.requests, request)
+	pending.mu.Unlock()
+	return request
+}
+
+func (pending *pendingRequests) remove(request *pendingRequest) bool {
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	for i, r := range pending.requests {
+		if r == request {
+			pending.requests = append(pending.requests[:i], pending.requests[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (pending *pendingRequests) markSent(request *pendingRequest) {
+	pending.mu.Lock()
+	request.sent = true
+	pending.mu.Unlock()
+}
+
+// interrupted handles the loss of the connection: with retry the requests
+// written so far are marked to be sent again after the reconnect, otherwise
+// they all fail with ErrRequestInterrupted.
+func (pending *pendingRequests) interrupted(retry bool) {
+	if !retry {
+		pending.fail(ErrRequestInterrupted)
+		return
+	}
+	pending.mu.Lock()
+	for _, request := range pending.requests {
+		if request.sent {
+			request.retry = true
+		}
+	}
+	pending.mu.Unlock()
+}
+
+// fail ends every waiting request with err.
+func (pending *pendingRequests) fail(err error) {
+	pending.mu.Lock()
+	requests := pending.requests
+	pending.requests = nil
+	pending.mu.Unlock()
+	for _, request := range requests {
+		request.failed <- err
+	}
+}
+
+// retries returns the requests marked by interrupted, clearing the mark.
+func (pending *pendingRequests) retries() []*pendingRequest {
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	var retries []*pendingRequest
+	for _, request := range pending.requests {
+		if request.retry {
+			request.retry = false
+			retries = append(retries, request)
+		}
+	}
+	return retries
+}
+
+// retryRequests sends the requests written on the lost connection again
+// after a reconnect, see RetryRequestsOnReconnect.
+func (socket *Socket) retryRequests() {
+	for _, request := range socket.requests.retries() {
+		if err := socket.send(websocket.TextMessage, request.data); err != nil {
+			socket.log.error("retry request:", err)
+			return
+		}
+	}
+}
+
+func (pending *pendingRequests) waiting() bool {
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	return len(pending.requests) > 0
+}
+
+// deliver hands message to the first request it matches and reports whether
+// there was one. The matchers run without the lock held.
+func (pending *pendingRequests) deliver(message []byte) bool {
+	pending.mu.Lock()
+	requests := append([]*pendingRequest(nil), pending.requests...)
+	pending.mu.Unlock()
+	for _, request := range requests {
+		if !request.match(message) {
+			continue
+		}
+		// The request may have been cancelled meanwhile; then try the next.
+		if pending.remove(request) {
+			request.reply <- append(json.RawMessage(nil), message...)
+			return true
+		}
+	}
+	return false
+}
+
+// Request sends payload as JSON and waits for the reply, the first text
+// message for which match returns true, e.g. by comparing an id field. The
+// reply is consumed: it is not passed to OnTextMessage or the other message
+// callbacks, which keep receiving everything else. Matchers of concurrent
+// requests are tried in the order the requests were made, on the receive
+// goroutine, so they must be quick. Request returns ctx's error if it is
+// done first, ErrClosed if the socket is closed and ErrRequestInterrupted if
+// the connection is lost, unless RetryRequestsOnReconnect is set.
+func (socket *Socket) Request(ctx context.Context, payload interface{}, match func(json.RawMessage) bool) (json.RawMessage, error) {
+	request, err := socket.StartRequest(payload, match)
+	if err != nil {
+		return nil, err
+	}
+	defer request.Cancel()
+	return request.Wait(ctx)
+}
+
+// PendingRequest is a request made by StartRequest that is waiting for its
+// reply.
+type PendingRequest struct {
+	socket    *Socket
+	request   *pendingRequest
+	cancelled chan struct{}
+}
+
+// StartRequest sends payload like Request but returns without waiting for
+// the reply, so that the request can be cancelled on its own rather than
+// through a context shared with others.
+func (socket *Socket) StartRequest(payload interface{}, match func(json.RawMessage) bool) (*PendingRequest, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	request := socket.requests.add(match, data)
+	if err := socket.send(websocket.TextMessage, data); err != nil {
+		socket.log.error("write:", err)
+		socket.requests.remove(request)
+		return nil, err
+	}
+	socket.requests.markSent(request)
+	return &PendingRequest{socket: socket, request: request, cancelled: make(chan struct{})}, nil
+}
+
+// Wait waits for the reply as Request does. It returns ErrRequestCancelled
+// once the request is cancelled.
+func (request *PendingRequest) Wait(ctx context.Context) (json.RawMessage, error) {
+	select {
+	case reply := <-request.request.reply:
+		return reply, nil
+	case err := <-request.request.failed:
+		return nil, err
+	case <-request.cancelled:
+		return nil, ErrRequestCancelled
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-request.socket.done:
+		return nil, ErrClosed
+	}
+}
+
+// Cancel stops waiting for the reply: its matcher is removed, so a matching
+// message that arrives later goes to the message callbacks. It has no effect
+// once the reply has arrived.
+func (request *PendingRequest) Cancel() {
+	if request.socket.requests.remove(request.request) {
+		close(request.cancelled)
+	}
+}
@@ -0,0 +1,142 @@
+package gowebsocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// replyAfter answers every message with the same payload once release
+// allows it.
+func replyAfter(release <-chan struct{}) func(conn *websocket.Conn) {
+	return func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			<-release
+			conn.WriteMessage(websocket.TextMessage, data)
+		}
+	}
+}
+
+func matchAll(json.RawMessage) bool { return true }
+
+func TestRequest(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	_, url := startServer(t, replyAfter(release))
+	socket := New(url)
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := socket.Request(ctx, map[string]int{"id": 1}, matchAll)
+	if err != nil || string(reply) != `{"id":1}` {
+		t.Fatalf("Request = %s, %v", reply, err)
+	}
+	if socket.requests.waiting() {
+		t.Fatal("waiter left behind after the reply")
+	}
+}
+
+func TestPendingRequestCancel(t *testing.T) {
+	release := make(chan struct{})
+	_, url := startServer(t, replyAfter(release))
+	socket := New(url)
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	request, err := socket.StartRequest(map[string]int{"id": 1}, matchAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Cancel()
+	if socket.requests.waiting() {
+		t.Fatal("waiter left behind after Cancel")
+	}
+	if _, err := request.Wait(context.Background()); err != ErrRequestCancelled {
+		t.Fatalf("Wait after Cancel = %v, want ErrRequestCancelled", err)
+	}
+
+	close(release)
+	select {
+	case message := <-received:
+		if message != `{"id":1}` {
+			t.Fatalf("received %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the late reply was not passed to OnTextMessage")
+	}
+}
+
+// dropBeforeReply reads the request on the first connection and drops it
+// without replying; later connections echo every request back.
+func dropBeforeReply(requests *int32) func(conn *websocket.Conn) {
+	var connections int32
+	return func(conn *websocket.Conn) {
+		first := atomic.AddInt32(&connections, 1) == 1
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(requests, 1)
+			if first {
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, data)
+		}
+	}
+}
+
+func TestRequestInterruptedByReconnect(t *testing.T) {
+	var requests int32
+	_, url := startServer(t, dropBeforeReply(&requests))
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = 10 * time.Millisecond
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := socket.Request(ctx, map[string]int{"id": 1}, matchAll); err != ErrRequestInterrupted {
+		t.Fatalf("Request = %v, want ErrRequestInterrupted", err)
+	}
+	if socket.requests.waiting() {
+		t.Fatal("waiter left behind after the connection was lost")
+	}
+}
+
+func TestRequestRetriedOnReconnect(t *testing.T) {
+	var requests int32
+	_, url := startServer(t, dropBeforeReply(&requests))
+	socket := New(url)
+	socket.RetryRequestsOnReconnect = true
+	socket.ReconnectionOptions.Interval = 10 * time.Millisecond
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := socket.Request(ctx, map[string]int{"id": 1}, matchAll)
+	if err != nil || string(reply) != `{"id":1}` {
+		t.Fatalf("Request = %s, %v", reply, err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("server received the request %d times, want 2", n)
+	}
+}
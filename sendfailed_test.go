@@ -0,0 +1,144 @@
+package gowebsocket
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// brokenPipeConn completes the opening handshake but fails every later
+// write, like a connection the peer has gone from.
+type brokenPipeConn struct {
+	net.Conn
+}
+
+func (conn brokenPipeConn) Write(p []byte) (int, error) {
+	if strings.HasPrefix(string(p), "GET ") {
+		return conn.Conn.Write(p)
+	}
+	return 0, &net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE}
+}
+
+func TestOnSendFailedAfterRetry(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	var dials int32
+	var dialer net.Dialer
+	socket.ConnectionOptions.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return brokenPipeConn{conn}, nil
+	}
+	var failed []byte
+	var failedErr error
+	socket.OnSendFailed = func(messageType int, data []byte, err error, socket *Socket) {
+		failed, failedErr = data, err
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	err := socket.SendText("undelivered")
+	if err == nil {
+		t.Fatal("SendText succeeded")
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("dialed %d times, want a reconnect before the retry", n)
+	}
+	if string(failed) != "undelivered" || failedErr != err {
+		t.Fatalf("OnSendFailed got %q, %v", failed, failedErr)
+	}
+}
+
+func TestBrokenPipeReconnectsAndResends(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	var dials int32
+	var dialer net.Dialer
+	socket.ConnectionOptions.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil || atomic.AddInt32(&dials, 1) > 1 {
+			return conn, err
+		}
+		// Only the first connection is broken.
+		return brokenPipeConn{conn}, nil
+	}
+	socket.OnSendFailed = func(messageType int, data []byte, err error, socket *Socket) {
+		t.Errorf("OnSendFailed got %q after a successful resend", data)
+	}
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	if err := socket.SendText("resent"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("dialed %d times, want one reconnect", n)
+	}
+	select {
+	case message := <-received:
+		if message != "resent" {
+			t.Fatalf("received %q", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("resent message not echoed")
+	}
+	if n := socket.Stats().Disconnects[DisconnectWriteFailure]; n != 1 {
+		t.Fatalf("%d write failure disconnects, want 1", n)
+	}
+}
+
+func TestRejectedMessageKeepsConnection(t *testing.T) {
+	conn := newMockConn()
+	rejected := errors.New("rejected")
+	conn.writeErr = rejected
+	socket := New("ws://127.0.0.1:1")
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	var attempts int32
+	socket.OnReconnecting = func(attempt int, socket *Socket) { atomic.AddInt32(&attempts, 1) }
+	reported := make(chan error, 1)
+	socket.OnError = func(err error, socket *Socket) {
+		select {
+		case reported <- err:
+		default:
+		}
+	}
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	if err := socket.SendText("rejected"); err != rejected {
+		t.Fatalf("SendText = %v, want the write error", err)
+	}
+	if err := <-reported; !errors.Is(err, rejected) {
+		t.Fatalf("OnError got %v", err)
+	}
+
+	conn.mu.Lock()
+	conn.writeErr = nil
+	conn.mu.Unlock()
+	if err := socket.SendText("accepted"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 0 {
+		t.Fatalf("%d reconnect attempts after a rejected message", n)
+	}
+	writes := conn.writes()
+	if len(writes) != 1 || string(writes[0].data) != "accepted" {
+		t.Fatalf("written %v, want the later message on the same connection", writes)
+	}
+}
@@ -0,0 +1,112 @@
+package gowebsocket
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendOptions(t *testing.T) {
+	socket := New("")
+	socket.ConnectionOptions.UseCompression = false
+	socket.ConnectionOptions.NegotiateCompression = true
+	echoed := make(chan int, 10)
+	socket.OnTextMessage = func(message string, socket *Socket) { echoed <- websocket.TextMessage }
+	socket.OnBinaryMessage = func(data []byte, socket *Socket) { echoed <- websocket.BinaryMessage }
+	recorder := connectCompressed(t, &socket)
+
+	on, off := true, false
+	payload := []byte(strings.Repeat("compress me ", 100))
+	for _, test := range []struct {
+		name           string
+		opts           SendOptions
+		compressWrites bool
+		binary         bool
+		compressed     bool
+	}{
+		{"defaults", SendOptions{}, false, false, false},
+		{"Binary", SendOptions{Binary: true}, false, true, false},
+		{"Compress on", SendOptions{Compress: &on}, false, false, true},
+		{"Compress off", SendOptions{Compress: &off}, true, false, false},
+		{"Deadline", SendOptions{Deadline: time.Now().Add(5 * time.Second)}, false, false, false},
+		{"combined", SendOptions{Binary: true, Compress: &on, Deadline: time.Now().Add(5 * time.Second)}, false, true, true},
+	} {
+		socket.SetWriteCompression(test.compressWrites)
+		before := len(recorder.compressed())
+		if err := socket.SendWithOptions(payload, test.opts); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		select {
+		case <-echoed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no echo", test.name)
+		}
+
+		recorder.mu.Lock()
+		starts := append([]byte(nil), recorder.starts[before:]...)
+		recorder.mu.Unlock()
+		if len(starts) != 1 {
+			t.Fatalf("%s: %d frames written, want 1", test.name, len(starts))
+		}
+		messageType := websocket.TextMessage
+		if test.binary {
+			messageType = websocket.BinaryMessage
+		}
+		if opcode := int(starts[0] & 0x0f); opcode != messageType {
+			t.Errorf("%s: opcode %d, want %d", test.name, opcode, messageType)
+		}
+		if compressed := starts[0]&0x40 != 0; compressed != test.compressed {
+			t.Errorf("%s: compressed = %v, want %v", test.name, compressed, test.compressed)
+		}
+	}
+}
+
+func TestSendOptionsPastDeadline(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	// A timed out write breaks the connection; skip reconnecting for the
+	// retry, which would time out the same way.
+	socket.ReconnectionOptions.Times = -1
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	start := time.Now()
+	err := socket.SendWithOptions([]byte("late"), SendOptions{Binary: true, Deadline: time.Now().Add(-time.Second)})
+	netErr, ok := err.(net.Error)
+	if !ok || !netErr.Timeout() {
+		t.Fatalf("SendWithOptions = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("returned after %v", elapsed)
+	}
+}
+
+func TestSendTextWithDeadlineUnreadServer(t *testing.T) {
+	release := make(chan struct{})
+	_, url := startServer(t, func(conn *websocket.Conn) { <-release })
+	defer close(release)
+	socket := New(url)
+	// Don't retry the timed out write on a new connection.
+	socket.ReconnectionOptions.Times = -1
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	// Far more than the socket buffers hold while the server is not reading.
+	message := strings.Repeat("x", 16<<20)
+	start := time.Now()
+	err := socket.SendTextWithDeadline(message, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("returned after %v", elapsed)
+	}
+	netErr, ok := err.(net.Error)
+	if !ok || !netErr.Timeout() {
+		t.Fatalf("SendTextWithDeadline = %v, want a timeout", err)
+	}
+}
@@ -0,0 +1,139 @@
+package gowebsocket
+
+import (
+	"crypto/rand"
+	"errors"
+	"sync"
+)
+
+var ErrSendQueueFull = errors.New("gowebsocket: send queue full")
+
+var errQueuedMessageCorrupt = errors.New("gowebsocket: queued message too short to decrypt")
+
+type queuedMessage struct {
+	id          uint64
+	messageType int
+	data        []byte
+}
+
+// sendQueue holds messages sent while disconnected, see SendQueueSize.
+// Both it and its flush are used with sendMu held, which keeps queued and
+// direct writes in submission order.
+type sendQueue struct {
+	mu       sync.Mutex // Only for Len; writers hold sendMu
+	messages []queuedMessage
+}
+
+func (queue *sendQueue) add(id uint64, messageType int, data []byte, limit int) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if len(queue.messages) >= limit {
+		return ErrSendQueueFull
+	}
+	queue.messages = append(queue.messages, queuedMessage{id, messageType, append([]byte(nil), data...)})
+	return nil
+}
+
+// enqueue queues a message for the next connect, sealed with
+// SendQueueCipher if set. Once the socket is closed there is no next
+// connect, so it fails with ErrClosed instead.
+func (socket *Socket) enqueue(id uint64, messageType int, data []byte) error {
+	if socket.isClosed() {
+		return ErrClosed
+	}
+	if aead := socket.SendQueueCipher; aead != nil {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		data = aead.Seal(nonce, nonce, data, nil)
+	}
+	return socket.queue.add(id, messageType, data, socket.SendQueueSize)
+}
+
+// openQueued returns the payload of a queued message, decrypting it if
+// SendQueueCipher is set.
+func (socket *Socket) openQueued(data []byte) ([]byte, error) {
+	aead := socket.SendQueueCipher
+	if aead == nil {
+		return data, nil
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errQueuedMessageCorrupt
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+func (queue *sendQueue) len() int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	return len(queue.messages)
+}
+
+// bytes returns the payload size of the queued messages.
+func (queue *sendQueue) bytes() int {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	n := 0
+	for _, message := range queue.messages {
+		n += len(message.data)
+	}
+	return n
+}
+
+// flushSendQueue writes the queued messages in order after a connect,
+// stopping at the first failure and keeping the rest for the next one.
+func (socket *Socket) flushSendQueue() {
+	socket.sendMu.Lock()
+	queue := socket.queue
+	queue.mu.Lock()
+	messages := queue.messages
+	queue.messages = nil
+	queue.mu.Unlock()
+
+	delivered := make([]uint64, 0, len(messages))
+	for i, message := range messages {
+		data, err := socket.openQueued(message.data)
+		if err != nil {
+			// Only a SendQueueCipher changed while messages were queued
+			// gets here; trying again would not help.
+			socket.log.error("flush:", err)
+			socket.reportError(err)
+			continue
+		}
+		err = socket.write(message.id, message.messageType, data, nil)
+		if socket.SendQueueCipher != nil {
+			for j := range data {
+				data[j] = 0
+			}
+		}
+		if err != nil {
+			socket.log.error("flush:", err)
+			queue.mu.Lock()
+			queue.messages = append(messages[i:], queue.messages...)
+			queue.mu.Unlock()
+			socket.sendMu.Unlock()
+			return
+		}
+		if message.id != 0 {
+			delivered = append(delivered, message.id)
+		}
+	}
+	socket.sendMu.Unlock()
+	if len(messages) > 0 {
+		socket.log.info("Flushed", len(messages), "queued messages")
+	}
+	if socket.OnDelivered != nil {
+		for _, id := range delivered {
+			socket.OnDelivered(id, socket)
+		}
+	}
+}
+
+// SendQueueLen returns the number of messages waiting in the send queue,
+// see SendQueueSize. It is cheap and safe to call from any goroutine, so
+// callers can use it to hold back their own sends while the queue fills.
+func (socket *Socket) SendQueueLen() int {
+	return socket.queue.len()
+}
@@ -0,0 +1,179 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendQueueLen(t *testing.T) {
+	received := make(chan string, 10)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	})
+	socket := New(url)
+	socket.SendQueueSize = 5
+	for _, message := range []string{"a", "b", "c"} {
+		if err := socket.SendText(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := socket.SendQueueLen(); n != 3 {
+		t.Fatalf("SendQueueLen = %d, want 3", n)
+	}
+
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	if n := socket.SendQueueLen(); n != 0 {
+		t.Fatalf("SendQueueLen after connecting = %d, want 0", n)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("received %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q was not flushed", want)
+		}
+	}
+}
+
+func TestSendQueueFull(t *testing.T) {
+	socket := New("ws://127.0.0.1:1")
+	socket.SendQueueSize = 2
+	socket.SendText("a")
+	socket.SendText("b")
+	if err := socket.SendText("c"); err != ErrSendQueueFull {
+		t.Fatalf("SendText on a full queue = %v, want ErrSendQueueFull", err)
+	}
+	if n := socket.SendQueueLen(); n != 2 {
+		t.Fatalf("SendQueueLen = %d, want 2", n)
+	}
+}
+
+func TestSendQueueAcrossReconnect(t *testing.T) {
+	_, url := startServer(t, dropFirst())
+	socket := New(url)
+	socket.SendQueueSize = 3
+	socket.ReconnectionOptions.Interval = 10 * time.Millisecond
+	sendErrs := make(chan []error, 1)
+	var once sync.Once
+	socket.OnDisconnected = func(err error, socket *Socket) {
+		once.Do(func() {
+			var errs []error
+			for _, message := range []string{"a", "b", "c", "d"} {
+				errs = append(errs, socket.SendText(message))
+			}
+			sendErrs <- errs
+		})
+	}
+	received := make(chan string, 4)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	select {
+	case errs := <-sendErrs:
+		for i, err := range errs[:3] {
+			if err != nil {
+				t.Fatalf("send %d while disconnected failed: %v", i, err)
+			}
+		}
+		if errs[3] != ErrSendQueueFull {
+			t.Fatalf("send on a full queue returned %v, want ErrSendQueueFull", errs[3])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lost connection was not reported")
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("received %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q was not sent after reconnecting", want)
+		}
+	}
+}
+
+func TestSendQueueAfterClose(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	socket.SendQueueSize = 5
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	socket.Close()
+	if err := socket.SendText("late"); err != ErrClosed {
+		t.Errorf("SendText after Close returned %v, want ErrClosed", err)
+	}
+	if err := socket.SendTextBatch([]string{"late"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("SendTextBatch after Close returned %v, want ErrClosed", err)
+	}
+	if n := socket.SendQueueLen(); n != 0 {
+		t.Errorf("SendQueueLen = %d, want 0", n)
+	}
+}
+
+func TestSendQueueCipher(t *testing.T) {
+	received := make(chan string, 1)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		received <- string(data)
+		conn.ReadMessage()
+	})
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := New(url)
+	socket.SendQueueSize = 1
+	socket.SendQueueCipher = aead
+	const secret = "the password is swordfish"
+	if err := socket.SendText(secret); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range socket.queue.messages {
+		if bytes.Contains(message.data, []byte(secret)) {
+			t.Fatal("queued message stored in plaintext")
+		}
+	}
+
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case got := <-received:
+		if got != secret {
+			t.Fatalf("received %q, want %q", got, secret)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued message was not flushed")
+	}
+}
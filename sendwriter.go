@@ -0,0 +1,133 @@
+package gowebsocket
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// SendWriter starts a text or binary message whose payload is streamed
+// through the returned writer, so a large one never has to be held in memory
+// as a whole. Other sends wait until the writer is closed, which sends the
+// final frame; it must be closed even after a failed Write. Streamed
+// messages are not queued while disconnected, kept for
+// ResendUnackedOnReconnect, passed to OnSendFailed or intercepted by
+// OutboundInterceptors. With Timeout set each Write gets its own deadline.
+func (socket *Socket) SendWriter(messageType int) (io.WriteCloser, error) {
+	if err := socket.lockWithinWindow(messageType); err != nil {
+		return nil, err
+	}
+	conn := socket.conn()
+	if conn == nil {
+		socket.sendMu.Unlock()
+		return nil, ErrNotConnected
+	}
+	w, err := conn.NextWriter(messageType)
+	if err != nil {
+		socket.sendMu.Unlock()
+		socket.writeFailed(err)
+		return nil, err
+	}
+	return &messageWriter{
+		socket:      socket,
+		conn:        conn,
+		messageType: messageType,
+		id:          atomic.AddUint64(socket.messageID, 1),
+		w:           w,
+	}, nil
+}
+
+// messageWriter holds sendMu from SendWriter until Close.
+type messageWriter struct {
+	socket      *Socket
+	conn        connection
+	messageType int
+	id          uint64
+	w           io.WriteCloser
+	size        int
+	err         error
+	closed      bool
+}
+
+func (writer *messageWriter) Write(p []byte) (int, error) {
+	if err := writer.begin(); err != nil {
+		return 0, err
+	}
+	n, err := writer.w.Write(p)
+	return writer.wrote(n, err)
+}
+
+// WriteString writes s without first copying it to a byte slice, so text
+// can be sent without the conversion SendText makes.
+func (writer *messageWriter) WriteString(s string) (int, error) {
+	stringWriter, ok := writer.w.(io.StringWriter)
+	if !ok {
+		return writer.Write([]byte(s))
+	}
+	if err := writer.begin(); err != nil {
+		return 0, err
+	}
+	n, err := stringWriter.WriteString(s)
+	return writer.wrote(n, err)
+}
+
+// begin checks that the message can still be written to and applies
+// Timeout to the write that follows.
+func (writer *messageWriter) begin() error {
+	if writer.closed {
+		return ErrClosed
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+	if timeout := writer.socket.Timeout; timeout != 0 {
+		writer.conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	return nil
+}
+
+func (writer *messageWriter) wrote(n int, err error) (int, error) {
+	writer.size += n
+	writer.err = err
+	return n, err
+}
+
+// Close finishes the message and lets other sends proceed. A failure that
+// broke the connection is handled like one of SendText, without the resend.
+func (writer *messageWriter) Close() error {
+	if writer.closed {
+		return nil
+	}
+	writer.closed = true
+	socket := writer.socket
+	err := writer.w.Close()
+	if writer.err != nil {
+		err = writer.err
+	}
+	if socket.Timeout != 0 {
+		writer.conn.SetWriteDeadline(time.Time{})
+	}
+	socket.sendMu.Unlock()
+
+	if err != nil {
+		socket.writeFailed(err)
+		return err
+	}
+	socket.stats.outbound.count(writer.messageType)
+	socket.sent(writer.id, writer.size)
+	if socket.OnDelivered != nil {
+		socket.OnDelivered(writer.id, socket)
+	}
+	return nil
+}
+
+// writeFailed reports a failed write that is not retried, reconnecting if
+// the connection broke.
+func (socket *Socket) writeFailed(err error) {
+	socket.log.error("send:", err)
+	socket.reportError(newConnError("write", err))
+	if isConnectionError(err) {
+		socket.disconnectedAs(DisconnectWriteFailure, err)
+		socket.recoverConnection()
+	}
+}
@@ -0,0 +1,121 @@
+package gowebsocket
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendWriter(t *testing.T) {
+	received := make(chan []byte, 2)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		conn.SetReadLimit(-1)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- data
+		}
+	})
+	socket := New(url)
+	socket.ConnectionOptions.PoolWriteBuffers = true
+	socket.Timeout = time.Second
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	writer, err := socket.SendWriter(websocket.BinaryMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sent while the writer is open, so it must wait for Close.
+	sent := make(chan error)
+	go func() { sent <- socket.SendText("after") }()
+	chunk := bytes.Repeat([]byte("x"), 64<<10)
+	for i := 0; i < 16; i++ {
+		if _, err := writer.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() []byte {
+		select {
+		case data := <-received:
+			return data
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+			return nil
+		}
+	}
+	if data := next(); len(data) != 1<<20 {
+		t.Fatalf("streamed message has %d bytes, want %d", len(data), 1<<20)
+	}
+	if data := next(); string(data) != "after" {
+		t.Fatalf("received %q, want %q", data, "after")
+	}
+	if id := socket.LastSentID(); id != 2 {
+		t.Errorf("LastSentID is %d, want 2", id)
+	}
+	if binary := socket.Stats().Outbound.Binary; binary != 1 {
+		t.Errorf("%d binary messages counted, want 1", binary)
+	}
+}
+
+// benchmarkSend calls send b.N times on a socket connected to a server that
+// discards what it reads.
+func benchmarkSend(b *testing.B, poolWriteBuffers bool, send func(socket *Socket)) {
+	_, url := startServer(b, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	})
+	socket := New(url)
+	socket.ConnectionOptions.PoolWriteBuffers = poolWriteBuffers
+	if err := socket.Connect(); err != nil {
+		b.Fatal(err)
+	}
+	defer socket.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		send(&socket)
+	}
+}
+
+var (
+	benchmarkPayload = bytes.Repeat([]byte("x"), 1024)
+	benchmarkText    = string(benchmarkPayload[:512])
+)
+
+func BenchmarkSendBinary(b *testing.B) {
+	benchmarkSend(b, false, func(socket *Socket) { socket.SendBinary(benchmarkPayload) })
+}
+
+func BenchmarkSendBinaryPooled(b *testing.B) {
+	benchmarkSend(b, true, func(socket *Socket) { socket.SendBinary(benchmarkPayload) })
+}
+
+func BenchmarkSendText(b *testing.B) {
+	benchmarkSend(b, false, func(socket *Socket) { socket.SendText(benchmarkText) })
+}
+
+func BenchmarkSendWriterText(b *testing.B) {
+	benchmarkSend(b, false, func(socket *Socket) {
+		writer, _ := socket.SendWriter(websocket.TextMessage)
+		io.WriteString(writer, benchmarkText)
+		writer.Close()
+	})
+}
@@ -0,0 +1,76 @@
+package gowebsocket
+
+import "sync/atomic"
+
+// ConnectionState is a stage in the socket's lifecycle, see State.
+type ConnectionState int32
+
+const (
+	StateDisconnected ConnectionState = iota // Not connected yet, or dropped without reconnecting
+	StateConnecting                          // Connect is dialing
+	StateConnected                           // A connection is up
+	StateReconnecting                        // Reconnect is dialing or waiting between attempts
+	StateClosed                              // Closed for good; final
+)
+
+func (state ConnectionState) String() string {
+	switch state {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// State returns where the socket is in its lifecycle. Unlike IsConnected it
+// tells an ongoing reconnect apart from a socket that has given up. It is
+// safe to call from any goroutine.
+func (socket *Socket) State() ConnectionState {
+	return ConnectionState(atomic.LoadInt32(socket.state))
+}
+
+// setState moves to state, unless the socket is already closed.
+func (socket *Socket) setState(state ConnectionState) {
+	for {
+		current := atomic.LoadInt32(socket.state)
+		if ConnectionState(current) == StateClosed {
+			return
+		}
+		if atomic.CompareAndSwapInt32(socket.state, current, int32(state)) {
+			return
+		}
+	}
+}
+
+// beginConnect moves a disconnected socket to StateConnecting, so that only
+// one of several concurrent Connect calls goes on to dial. A closed socket
+// stays closed and cannot be connected again.
+func (socket *Socket) beginConnect() error {
+	for {
+		switch socket.State() {
+		case StateConnecting, StateReconnecting:
+			return ErrAlreadyConnecting
+		case StateConnected:
+			return ErrAlreadyConnected
+		case StateClosed:
+			return ErrClosed
+		}
+		if atomic.CompareAndSwapInt32(socket.state, int32(StateDisconnected), int32(StateConnecting)) {
+			return nil
+		}
+	}
+}
+
+// markClosed closes the socket for good: done is closed, ending any reconnect
+// loop, and the state becomes StateClosed.
+func (socket *Socket) markClosed() {
+	socket.doneOnce.Do(func() { close(socket.done) })
+	socket.setState(StateClosed)
+}
@@ -0,0 +1,59 @@
+package gowebsocket
+
+import (
+	"testing"
+	"time"
+)
+
+// TestIsConnectedWhileReconnecting reads the connection state from another
+// goroutine while the socket loses its connection and reconnects. Run it
+// with -race.
+func TestIsConnectedWhileReconnecting(t *testing.T) {
+	_, url := startServer(t, dropFirst())
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	connected := make(chan struct{}, 2)
+	socket.OnConnected = func(socket *Socket) { connected <- struct{}{} }
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				socket.IsConnected()
+				socket.State()
+			}
+		}
+	}()
+
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-connected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the socket did not reconnect")
+		}
+	}
+	if err := socket.SendText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("echo not received")
+	}
+	close(stop)
+	<-stopped
+	if !socket.IsConnected() {
+		t.Errorf("state is %v after reconnecting, want StateConnected", socket.State())
+	}
+}
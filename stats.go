@@ -0,0 +1,352 @@
+package gowebsocket
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Stats is a point-in-time snapshot of a socket's traffic counters.
+type Stats struct {
+	Name               string // The socket's name, see SetName
+	MessagesSent       uint64
+	MessagesReceived   uint64
+	BytesSent          uint64
+	BytesReceived      uint64
+	Reconnects         uint64
+	SessionID          uint64        // See Socket.SessionID
+	LastConnectedAt    time.Time     // When the latest connection was established, zero if never
+	RTT                time.Duration // Smoothed ping round-trip time, 0 until measured
+	LastDisconnectedAt time.Time
+	LastDisconnectErr  error
+	// Disconnects counts disconnects by cause. Categories that never
+	// occurred are absent.
+	Disconnects map[DisconnectCategory]uint64
+	// ReconnectSuccessRate is the share of reconnect attempts within
+	// ReconnectionOptions.SuccessRateWindow that succeeded, or 1 if there
+	// were none.
+	ReconnectSuccessRate float64
+	TextCallback         CallbackStats // Time spent in OnTextMessage
+	BinaryCallback       CallbackStats // Time spent in OnBinaryMessage
+	Inbound              FrameCounts   // Frames read, by opcode
+	Outbound             FrameCounts   // Frames written, by opcode
+}
+
+// DisconnectCategory classifies why a connection was lost.
+type DisconnectCategory string
+
+const (
+	DisconnectNormal        DisconnectCategory = "normal"         // Close code 1000, or Close
+	DisconnectGoingAway     DisconnectCategory = "going_away"     // Close code 1001
+	DisconnectAbnormal      DisconnectCategory = "abnormal"       // Close code 1006, the connection dropped without a close frame
+	DisconnectTimeout       DisconnectCategory = "timeout"        // Read deadline exceeded
+	DisconnectWriteFailure  DisconnectCategory = "write_failure"  // A send failed
+	DisconnectProtocolError DisconnectCategory = "protocol_error" // Close codes 1002, 1003 and 1007, a StrictMode violation or MaxMessageSize exceeded
+	DisconnectOther         DisconnectCategory = "other"
+)
+
+// FrameCounts counts frames by opcode.
+type FrameCounts struct {
+	Text   uint64
+	Binary uint64
+	Ping   uint64
+	Pong   uint64
+	Close  uint64
+}
+
+// frameCounters is the atomically updated form of FrameCounts.
+type frameCounters struct {
+	text   uint64
+	binary uint64
+	ping   uint64
+	pong   uint64
+	close  uint64
+}
+
+func (counters *frameCounters) count(messageType int) {
+	switch messageType {
+	case websocket.TextMessage:
+		atomic.AddUint64(&counters.text, 1)
+	case websocket.BinaryMessage:
+		atomic.AddUint64(&counters.binary, 1)
+	case websocket.PingMessage:
+		atomic.AddUint64(&counters.ping, 1)
+	case websocket.PongMessage:
+		atomic.AddUint64(&counters.pong, 1)
+	case websocket.CloseMessage:
+		atomic.AddUint64(&counters.close, 1)
+	}
+}
+
+func (counters *frameCounters) snapshot() FrameCounts {
+	return FrameCounts{
+		Text:   atomic.LoadUint64(&counters.text),
+		Binary: atomic.LoadUint64(&counters.binary),
+		Ping:   atomic.LoadUint64(&counters.ping),
+		Pong:   atomic.LoadUint64(&counters.pong),
+		Close:  atomic.LoadUint64(&counters.close),
+	}
+}
+
+// CallbackStats summarizes how long a message callback took to run. P95 is
+// computed over the most recent callbackSamples invocations.
+type CallbackStats struct {
+	Count uint64
+	Min   time.Duration
+	Max   time.Duration
+	Avg   time.Duration
+	P95   time.Duration
+}
+
+const callbackSamples = 256
+
+type callbackTimer struct {
+	mu      sync.Mutex
+	count   uint64
+	total   time.Duration
+	min     time.Duration
+	max     time.Duration
+	samples [callbackSamples]time.Duration
+}
+
+func (timer *callbackTimer) observe(d time.Duration) {
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+	if timer.count == 0 || d < timer.min {
+		timer.min = d
+	}
+	if d > timer.max {
+		timer.max = d
+	}
+	timer.samples[timer.count%callbackSamples] = d
+	timer.count++
+	timer.total += d
+}
+
+func (timer *callbackTimer) snapshot() CallbackStats {
+	timer.mu.Lock()
+	defer timer.mu.Unlock()
+	if timer.count == 0 {
+		return CallbackStats{}
+	}
+	n := timer.count
+	if n > callbackSamples {
+		n = callbackSamples
+	}
+	samples := append([]time.Duration(nil), timer.samples[:n]...)
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return CallbackStats{
+		Count: timer.count,
+		Min:   timer.min,
+		Max:   timer.max,
+		Avg:   timer.total / time.Duration(timer.count),
+		P95:   samples[(len(samples)*95+99)/100-1],
+	}
+}
+
+type socketStats struct {
+	// Accessed atomically; kept first for 64-bit alignment.
+	messagesSent     uint64
+	messagesReceived uint64
+	bytesSent        uint64
+	bytesReceived    uint64
+	reconnects       uint64
+	sessionID        uint64
+	lastPingAt       int64 // UnixNano of the ping awaiting a pong, 0 if none
+	lastConnectedAt  int64 // UnixNano, 0 if never connected
+	inbound          frameCounters
+	outbound         frameCounters
+
+	mu                 sync.Mutex
+	lastDisconnectedAt time.Time
+	lastDisconnectErr  error
+	reconnectAttempts  []reconnectAttempt
+	errors             []time.Time
+	disconnects        map[DisconnectCategory]uint64
+	rtt                time.Duration
+
+	textCallback   callbackTimer
+	binaryCallback callbackTimer
+}
+
+// connected records a new connection, starting a new session.
+func (stats *socketStats) connected(now time.Time) {
+	atomic.AddUint64(&stats.sessionID, 1)
+	atomic.StoreInt64(&stats.lastConnectedAt, now.UnixNano())
+}
+
+func (stats *socketStats) sent(n int) {
+	atomic.AddUint64(&stats.messagesSent, 1)
+	atomic.AddUint64(&stats.bytesSent, uint64(n))
+}
+
+func (stats *socketStats) received(n int) {
+	atomic.AddUint64(&stats.messagesReceived, 1)
+	atomic.AddUint64(&stats.bytesReceived, uint64(n))
+}
+
+// defaultSuccessRateWindow applies when SuccessRateWindow is zero.
+const defaultSuccessRateWindow = 10 * time.Minute
+
+type reconnectAttempt struct {
+	at        time.Time
+	succeeded bool
+}
+
+func (stats *socketStats) reconnectAttempted(succeeded bool, window time.Duration) {
+	now := time.Now()
+	stats.mu.Lock()
+	stats.reconnectAttempts = append(stats.pruneReconnectAttempts(now, window), reconnectAttempt{now, succeeded})
+	stats.mu.Unlock()
+}
+
+// pruneReconnectAttempts drops attempts older than window; stats.mu must be
+// held.
+func (stats *socketStats) pruneReconnectAttempts(now time.Time, window time.Duration) []reconnectAttempt {
+	if window <= 0 {
+		window = defaultSuccessRateWindow
+	}
+	i := 0
+	for i < len(stats.reconnectAttempts) && now.Sub(stats.reconnectAttempts[i].at) > window {
+		i++
+	}
+	stats.reconnectAttempts = stats.reconnectAttempts[i:]
+	return stats.reconnectAttempts
+}
+
+func (stats *socketStats) reconnectSuccessRate(window time.Duration) float64 {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	attempts := stats.pruneReconnectAttempts(time.Now(), window)
+	if len(attempts) == 0 {
+		return 1
+	}
+	succeeded := 0
+	for _, attempt := range attempts {
+		if attempt.succeeded {
+			succeeded++
+		}
+	}
+	return float64(succeeded) / float64(len(attempts))
+}
+
+func (stats *socketStats) disconnected(category DisconnectCategory, err error) {
+	stats.mu.Lock()
+	stats.lastDisconnectedAt = time.Now()
+	stats.lastDisconnectErr = err
+	if stats.disconnects == nil {
+		stats.disconnects = make(map[DisconnectCategory]uint64)
+	}
+	stats.disconnects[category]++
+	stats.mu.Unlock()
+}
+
+// Stats returns a snapshot of the socket's traffic counters. It is safe to
+// call concurrently with sends and receives.
+func (socket *Socket) Stats() Stats {
+	stats := socket.stats
+	snapshot := Stats{
+		Name:             socket.Name(),
+		MessagesSent:     atomic.LoadUint64(&stats.messagesSent),
+		MessagesReceived: atomic.LoadUint64(&stats.messagesReceived),
+		BytesSent:        atomic.LoadUint64(&stats.bytesSent),
+		BytesReceived:    atomic.LoadUint64(&stats.bytesReceived),
+		Reconnects:       atomic.LoadUint64(&stats.reconnects),
+		SessionID:        atomic.LoadUint64(&stats.sessionID),
+	}
+	if connectedAt := atomic.LoadInt64(&stats.lastConnectedAt); connectedAt != 0 {
+		snapshot.LastConnectedAt = time.Unix(0, connectedAt)
+	}
+	stats.mu.Lock()
+	snapshot.LastDisconnectedAt = stats.lastDisconnectedAt
+	snapshot.LastDisconnectErr = stats.lastDisconnectErr
+	snapshot.RTT = stats.rtt
+	snapshot.Disconnects = make(map[DisconnectCategory]uint64, len(stats.disconnects))
+	for category, count := range stats.disconnects {
+		snapshot.Disconnects[category] = count
+	}
+	stats.mu.Unlock()
+	snapshot.ReconnectSuccessRate = stats.reconnectSuccessRate(socket.reconnectionOptions().SuccessRateWindow)
+	snapshot.TextCallback = stats.textCallback.snapshot()
+	snapshot.BinaryCallback = stats.binaryCallback.snapshot()
+	snapshot.Inbound = stats.inbound.snapshot()
+	snapshot.Outbound = stats.outbound.snapshot()
+	return snapshot
+}
+
+// countingReader counts bytes streamed to an OnMessageReader callback.
+type countingReader struct {
+	reader io.Reader
+	n      int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+// BufferedBytes estimates the memory held for this socket's messages: rx
+// is received data waiting in the Messages channel or for OnBatch, and tx is
+// outbound data in the send queue (see SendQueueSize) or kept for resending
+// (see ResendUnackedOnReconnect).
+func (socket *Socket) BufferedBytes() (rx, tx int) {
+	messages := socket.messages
+	messages.mu.Lock()
+	if messages.ch != nil {
+		rx = messages.sizes.total(len(messages.ch))
+	}
+	messages.mu.Unlock()
+	rx += socket.batchSizes.total(len(socket.batch))
+
+	socket.unacked.mu.Lock()
+	tx = socket.unacked.bytes
+	socket.unacked.mu.Unlock()
+	tx += socket.queue.bytes()
+	return rx, tx
+}
+
+// bufferedSizes remembers the sizes of the last messages put into a buffered
+// channel. Those still waiting in it are always the most recent ones, so
+// their total can be told from the channel's length.
+type bufferedSizes struct {
+	mu    sync.Mutex
+	sizes []int // A ring as long as the channel's capacity
+	next  int
+}
+
+func newBufferedSizes(capacity int) *bufferedSizes {
+	return &bufferedSizes{sizes: make([]int, capacity)}
+}
+
+func (buffered *bufferedSizes) add(size int) {
+	buffered.mu.Lock()
+	buffered.sizes[buffered.next%len(buffered.sizes)] = size
+	buffered.next++
+	buffered.mu.Unlock()
+}
+
+// total returns the size of the last waiting messages added.
+func (buffered *bufferedSizes) total(waiting int) int {
+	buffered.mu.Lock()
+	defer buffered.mu.Unlock()
+	if waiting > buffered.next {
+		waiting = buffered.next
+	}
+	n := 0
+	for i := 1; i <= waiting; i++ {
+		n += buffered.sizes[(buffered.next-i)%len(buffered.sizes)]
+	}
+	return n
+}
+
+// SessionID identifies the current connection. It is incremented by every
+// successful dial, before OnConnected runs, so a changed value shows that a
+// reconnect established a new connection. It is 0 before the first connect.
+func (socket *Socket) SessionID() uint64 {
+	return atomic.LoadUint64(&socket.stats.sessionID)
+}
@@ -0,0 +1,202 @@
+package gowebsocket
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCallbackStats(t *testing.T) {
+	conn := newMockConn()
+	socket := New("ws://127.0.0.1:1")
+	socket.OnTextMessage = func(message string, socket *Socket) {
+		duration, _ := time.ParseDuration(message)
+		time.Sleep(duration)
+	}
+	socket.OnBinaryMessage = func(data []byte, socket *Socket) { time.Sleep(5 * time.Millisecond) }
+	useConn(&socket, conn)
+	defer socket.Close()
+
+	for i := 0; i < 9; i++ {
+		conn.inbound <- mockMessage{websocket.TextMessage, []byte("10ms")}
+	}
+	conn.inbound <- mockMessage{websocket.TextMessage, []byte("50ms")}
+	conn.inbound <- mockMessage{websocket.BinaryMessage, nil}
+	waitUntil(t, "callbacks not recorded", func() bool {
+		stats := socket.Stats()
+		return stats.TextCallback.Count == 10 && stats.BinaryCallback.Count == 1
+	})
+
+	stats := socket.Stats()
+	text := stats.TextCallback
+	inRange := func(name string, d, min, max time.Duration) {
+		t.Helper()
+		if d < min || d >= max {
+			t.Errorf("%s = %v, want within [%v, %v)", name, d, min, max)
+		}
+	}
+	inRange("text Min", text.Min, 10*time.Millisecond, 50*time.Millisecond)
+	inRange("text Max", text.Max, 50*time.Millisecond, 200*time.Millisecond)
+	inRange("text Avg", text.Avg, 14*time.Millisecond, 50*time.Millisecond)
+	inRange("text P95", text.P95, text.Min, text.Max+1)
+	inRange("binary Min", stats.BinaryCallback.Min, 5*time.Millisecond, 100*time.Millisecond)
+}
+
+func TestReconnectSuccessRate(t *testing.T) {
+	socket := New(refusingServer(t, 2))
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	reconnected := make(chan struct{}, 1)
+	socket.OnReconnected = func(socket *Socket) { reconnected <- struct{}{} }
+	if rate := socket.Stats().ReconnectSuccessRate; rate != 1 {
+		t.Fatalf("rate before any attempt = %v, want 1", rate)
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not reconnect")
+	}
+	// Two refused attempts, then one that succeeded.
+	if rate := socket.Stats().ReconnectSuccessRate; rate != 1.0/3 {
+		t.Fatalf("rate = %v, want 1/3", rate)
+	}
+}
+
+func TestReconnectSuccessRateWindow(t *testing.T) {
+	var stats socketStats
+	const window = 50 * time.Millisecond
+	stats.reconnectAttempted(false, window)
+	stats.reconnectAttempted(true, window)
+	if rate := stats.reconnectSuccessRate(window); rate != 0.5 {
+		t.Fatalf("rate = %v, want 0.5", rate)
+	}
+	time.Sleep(2 * window)
+	stats.reconnectAttempted(true, window)
+	if rate := stats.reconnectSuccessRate(window); rate != 1 {
+		t.Fatalf("rate once the failure left the window = %v, want 1", rate)
+	}
+}
+
+func TestFrameCounts(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		// Reading the four data messages also answers the client's ping.
+		for i := 0; i < 4; i++ {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte("one"))
+		conn.WriteMessage(websocket.TextMessage, []byte("two"))
+		conn.WriteMessage(websocket.BinaryMessage, []byte{3})
+		conn.WriteMessage(websocket.PingMessage, nil)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.ReadMessage()
+	})
+	socket := New(url)
+	socket.ManualReconnect = true
+	disconnected := make(chan struct{})
+	socket.OnDisconnected = func(err error, socket *Socket) { close(disconnected) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	socket.SendText("a")
+	socket.SendText("b")
+	socket.SendPing(nil, time.Now().Add(time.Second))
+	socket.SendText("c")
+	socket.SendBinary([]byte{4})
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server close not seen")
+	}
+
+	stats := socket.Stats()
+	if want := (FrameCounts{Text: 2, Binary: 1, Ping: 1, Pong: 1, Close: 1}); stats.Inbound != want {
+		t.Errorf("Inbound = %+v, want %+v", stats.Inbound, want)
+	}
+	if want := (FrameCounts{Text: 3, Binary: 1, Ping: 1, Pong: 1, Close: 1}); stats.Outbound != want {
+		t.Errorf("Outbound = %+v, want %+v", stats.Outbound, want)
+	}
+}
+
+func TestSessionIDAcrossReconnect(t *testing.T) {
+	_, url := startServer(t, dropFirst())
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	sessions := make(chan uint64, 2)
+	socket.OnConnected = func(socket *Socket) { sessions <- socket.SessionID() }
+	if id := socket.SessionID(); id != 0 {
+		t.Fatalf("SessionID before connecting = %d, want 0", id)
+	}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	var ids []uint64
+	for len(ids) < 2 {
+		select {
+		case id := <-sessions:
+			ids = append(ids, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("did not reconnect")
+		}
+	}
+	if ids[0] == 0 || ids[1] <= ids[0] {
+		t.Fatalf("session IDs %v, want them to go up from 1", ids)
+	}
+	if id := socket.Stats().SessionID; id != ids[1] {
+		t.Fatalf("Stats().SessionID = %d, want %d", id, ids[1])
+	}
+}
+
+func TestDisconnectCategories(t *testing.T) {
+	var connections int32
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		closeWith := func(code int) {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""))
+			conn.ReadMessage()
+		}
+		switch atomic.AddInt32(&connections, 1) {
+		case 1:
+			closeWith(websocket.CloseGoingAway)
+		case 2:
+			// Drop the connection without a close frame.
+		case 3:
+			closeWith(websocket.CloseProtocolError)
+		default:
+			echo(conn)
+		}
+	})
+	socket := New(url)
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	var reconnects int32
+	socket.OnReconnected = func(socket *Socket) { atomic.AddInt32(&reconnects, 1) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, "three reconnects", func() bool { return atomic.LoadInt32(&reconnects) == 3 })
+	socket.Close()
+
+	want := map[DisconnectCategory]uint64{
+		DisconnectGoingAway:     1,
+		DisconnectAbnormal:      1,
+		DisconnectProtocolError: 1,
+		DisconnectNormal:        1,
+	}
+	disconnects := socket.Stats().Disconnects
+	if len(disconnects) != len(want) {
+		t.Errorf("Disconnects = %v, want %v", disconnects, want)
+	}
+	for category, count := range want {
+		if disconnects[category] != count {
+			t.Errorf("Disconnects[%s] = %d, want %d", category, disconnects[category], count)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package gowebsocket
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStrictModeInvalidUTF8(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		closeCode := make(chan int, 1)
+		_, url := startServer(t, func(conn *websocket.Conn) {
+			conn.WriteMessage(websocket.TextMessage, []byte{'b', 'a', 'd', 0xff})
+			conn.WriteMessage(websocket.TextMessage, []byte("good"))
+			_, _, err := conn.ReadMessage()
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				closeCode <- closeErr.Code
+			}
+		})
+		socket := New(url)
+		socket.StrictMode = strict
+		received := make(chan string, 2)
+		socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+		disconnected := make(chan error, 1)
+		socket.OnDisconnected = func(err error, socket *Socket) { disconnected <- err }
+		if err := socket.Connect(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strict {
+			for _, want := range []string{"bad\xff", "good"} {
+				select {
+				case message := <-received:
+					if message != want {
+						t.Fatalf("received %q, want %q", message, want)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("message not delivered outside StrictMode")
+				}
+			}
+			if !socket.IsConnected() {
+				t.Fatal("disconnected outside StrictMode")
+			}
+			socket.Close()
+			continue
+		}
+
+		select {
+		case code := <-closeCode:
+			if code != websocket.CloseInvalidFramePayloadData {
+				t.Fatalf("server got close code %d", code)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("server got no close frame")
+		}
+		select {
+		case err := <-disconnected:
+			var protocolErr *ProtocolError
+			if !errors.As(err, &protocolErr) {
+				t.Fatalf("OnDisconnected got %v, want a *ProtocolError", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("OnDisconnected not called")
+		}
+		select {
+		case message := <-received:
+			t.Fatalf("%q delivered in StrictMode", message)
+		default:
+		}
+		if state := socket.State(); state != StateClosed {
+			t.Fatalf("state is %v, want StateClosed", state)
+		}
+		socket.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package gowebsocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSubprotocol(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	if got := socket.Subprotocol(); got != "" {
+		t.Fatalf("Subprotocol before connecting = %q", got)
+	}
+	socket.ConnectionOptions.Subprotocols = []string{"chat"}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if got := socket.Subprotocol(); got != "chat" {
+		t.Fatalf("Subprotocol = %q, want chat", got)
+	}
+	socket.Close()
+	if got := socket.Subprotocol(); got != "" {
+		t.Fatalf("Subprotocol after Close = %q", got)
+	}
+}
+
+func TestSubprotocolNoneSelected(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) { conn.ReadMessage() })
+	socket := New(url)
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	if got := socket.Subprotocol(); got != "" {
+		t.Fatalf("Subprotocol = %q, want none", got)
+	}
+}
+
+func TestSubprotocolMismatch(t *testing.T) {
+	// Without Subprotocols of its own the upgrader answers with whatever
+	// the response header says, here one the client never offered.
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, http.Header{"Sec-Websocket-Protocol": {"other"}})
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	socket := New("ws" + strings.TrimPrefix(server.URL, "http"))
+	socket.ConnectionOptions.Subprotocols = []string{"chat"}
+	mismatch := make(chan error, 1)
+	socket.OnSubprotocolMismatch = func(err error, socket *Socket) { mismatch <- err }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	select {
+	case err := <-mismatch:
+		if !errors.Is(err, ErrSubprotocolMismatch) {
+			t.Fatalf("OnSubprotocolMismatch got %v, want ErrSubprotocolMismatch", err)
+		}
+	default:
+		t.Fatal("OnSubprotocolMismatch not called")
+	}
+}
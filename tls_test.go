@@ -0,0 +1,253 @@
+package gowebsocket
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startTLSServer runs a wss server with a self-signed certificate that
+// keeps each connection open until the client closes it.
+func startTLSServer(t *testing.T) (*httptest.Server, string) {
+	var upgrader websocket.Upgrader
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	// Rejected handshakes are expected; keep them out of the test output.
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, "wss" + strings.TrimPrefix(server.URL, "https")
+}
+
+func TestTLSConnectionState(t *testing.T) {
+	server, url := startTLSServer(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	socket := New(url)
+	if _, ok := socket.TLSConnectionState(); ok {
+		t.Fatal("TLS state reported before connecting")
+	}
+	socket.ConnectionOptions.TLSConfig = &tls.Config{RootCAs: roots}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	state, ok := socket.TLSConnectionState()
+	if !ok || !state.HandshakeComplete || len(state.PeerCertificates) == 0 {
+		t.Fatalf("TLSConnectionState = %+v, %v", state, ok)
+	}
+}
+
+func TestTLSConnectionStatePlain(t *testing.T) {
+	_, url := startServer(t, func(conn *websocket.Conn) { conn.ReadMessage() })
+	socket := New(url)
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	if _, ok := socket.TLSConnectionState(); ok {
+		t.Fatal("TLS state reported for a ws connection")
+	}
+}
+
+func TestUseSSLVerifiesCertificates(t *testing.T) {
+	_, url := startTLSServer(t)
+	socket := New(url)
+	if socket.Connect() == nil {
+		socket.Close()
+		t.Fatal("connected to a server with an untrusted certificate")
+	}
+
+	socket = New(url)
+	socket.ConnectionOptions.InsecureSkipVerify = true
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	socket.Close()
+}
+
+// newCertificate returns a self-signed certificate for 127.0.0.1.
+func newCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestTLSConfigProviderPicksUpRotatedCA(t *testing.T) {
+	oldPair, oldCert := newCertificate(t)
+	newPair, newCert := newCertificate(t)
+	var serving atomic.Value
+	serving.Store(&oldPair)
+
+	var upgrader websocket.Upgrader
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.ReadMessage()
+		}),
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	go server.Serve(tls.NewListener(listener, &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return serving.Load().(*tls.Certificate), nil
+		},
+	}))
+	defer server.Close()
+
+	var trusted atomic.Value
+	trust := func(cert *x509.Certificate) {
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+		trusted.Store(roots)
+	}
+	trust(oldCert)
+	socket := New("wss://" + listener.Addr().String())
+	socket.ReconnectionOptions.Interval = 10 * time.Millisecond
+	socket.ConnectionOptions.TLSConfigProvider = func() *tls.Config {
+		return &tls.Config{RootCAs: trusted.Load().(*x509.CertPool)}
+	}
+	reconnected := make(chan struct{}, 1)
+	socket.OnReconnected = func(socket *Socket) { reconnected <- struct{}{} }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	// Rotate the certificate and drop the connection.
+	serving.Store(&newPair)
+	trust(newCert)
+	socket.SendText("drop")
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not reconnect with the new CA")
+	}
+	state, ok := socket.TLSConnectionState()
+	if !ok || !state.PeerCertificates[0].Equal(newCert) {
+		t.Fatal("reconnected without the rotated certificate")
+	}
+}
+
+func TestAttemptHistoryTLSTimings(t *testing.T) {
+	server, url := startTLSServer(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	socket := New(url)
+	socket.ConnectionOptions.TLSConfig = &tls.Config{RootCAs: roots}
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	history := socket.AttemptHistory()
+	if len(history) != 1 {
+		t.Fatalf("%d attempts recorded, want 1", len(history))
+	}
+	record := history[0]
+	if record.Err != nil || record.Connect <= 0 || record.TLSHandshake <= 0 || record.Upgrade <= 0 {
+		t.Fatalf("record = %+v, want non-zero Connect, TLSHandshake and Upgrade", record)
+	}
+	if record.DNS != 0 {
+		t.Errorf("DNS = %v for an IP address, want 0", record.DNS)
+	}
+	if sum := record.Connect + record.TLSHandshake + record.Upgrade; sum > record.Duration {
+		t.Errorf("phases add up to %v, more than Duration %v", sum, record.Duration)
+	}
+}
+
+func TestInsecureDowngrade(t *testing.T) {
+	_, url := startServer(t, echo)
+	secure := "wss" + strings.TrimPrefix(url, "ws")
+
+	refused := New(secure)
+	if err := refused.Connect(); err == nil {
+		refused.Close()
+		t.Fatal("connected to a plaintext server over wss without AllowInsecureDowngrade")
+	}
+
+	socket := New(secure)
+	socket.ConnectionOptions.AllowInsecureDowngrade = true
+	received := make(chan string, 1)
+	socket.OnTextMessage = func(message string, socket *Socket) { received <- message }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	if _, ok := socket.TLSConnectionState(); ok {
+		t.Fatal("downgraded connection reports TLS")
+	}
+	socket.SendText("hello")
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no echo over the downgraded connection")
+	}
+
+	// A server that speaks TLS is never downgraded, even if its
+	// certificate is rejected.
+	_, tlsURL := startTLSServer(t)
+	untrusted := New(tlsURL)
+	untrusted.ConnectionOptions.AllowInsecureDowngrade = true
+	err := untrusted.Connect()
+	if err == nil {
+		untrusted.Close()
+		t.Fatal("connected to a server with an untrusted certificate")
+	}
+	// A plain ws retry would have been refused by the server's HTTPS
+	// listener with a bad handshake instead.
+	if err == websocket.ErrBadHandshake {
+		t.Fatal("retried a TLS server without encryption")
+	}
+}
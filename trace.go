@@ -0,0 +1,41 @@
+package gowebsocket
+
+import "time"
+
+// TraceEventType identifies what a TraceEvent reports.
+type TraceEventType string
+
+const (
+	TraceConnecting      TraceEventType = "connecting"       // A dial is starting
+	TraceConnected       TraceEventType = "connected"        // The handshake succeeded
+	TraceMessageSent     TraceEventType = "message_sent"     // A data frame was written
+	TraceMessageReceived TraceEventType = "message_received" // A data frame was read
+	TracePingSent        TraceEventType = "ping_sent"        // A ping was written
+	TracePongReceived    TraceEventType = "pong_received"    // A pong was read
+	TraceDisconnected    TraceEventType = "disconnected"     // The connection was lost or closed
+	TraceReconnecting    TraceEventType = "reconnecting"     // A reconnect attempt is starting
+	TraceClosed          TraceEventType = "closed"           // Close was called
+)
+
+// TraceEvent is a single event reported to OnTrace.
+type TraceEvent struct {
+	Type TraceEventType
+	Time time.Time
+	// Size is the payload size of frames, zero for other events and for
+	// messages streamed to OnMessageReader.
+	Size int
+	// Attempt is the reconnect attempt for TraceConnecting, TraceConnected
+	// and TraceReconnecting, 0 for the initial connect.
+	Attempt int
+	// Err is the cause of TraceDisconnected.
+	Err error
+}
+
+// traceEvent reports an event to OnTrace, if set.
+func (socket *Socket) traceEvent(event TraceEvent) {
+	if socket.OnTrace == nil {
+		return
+	}
+	event.Time = time.Now()
+	socket.OnTrace(event)
+}
@@ -0,0 +1,53 @@
+package gowebsocket
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceEvents(t *testing.T) {
+	_, url := startServer(t, echo)
+	socket := New(url)
+	var mu sync.Mutex
+	var events []TraceEvent
+	socket.OnTrace = func(event TraceEvent) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}
+	received := make(chan struct{})
+	socket.OnTextMessage = func(message string, socket *Socket) { close(received) }
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	socket.SendText("hello")
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("echo not received")
+	}
+	socket.Close()
+
+	want := []TraceEvent{
+		{Type: TraceConnecting},
+		{Type: TraceConnected},
+		{Type: TraceMessageSent, Size: 5},
+		{Type: TraceMessageReceived, Size: 5},
+		{Type: TraceDisconnected},
+		{Type: TraceClosed},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != len(want) {
+		t.Fatalf("events %+v, want %+v", events, want)
+	}
+	for i, event := range events {
+		if event.Type != want[i].Type || event.Size != want[i].Size || event.Attempt != 0 || event.Err != nil {
+			t.Errorf("event %d is %+v, want %+v", i, event, want[i])
+		}
+		if event.Time.IsZero() || i > 0 && event.Time.Before(events[i-1].Time) {
+			t.Errorf("event %d has time %v, out of order", i, event.Time)
+		}
+	}
+}
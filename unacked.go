@@ -0,0 +1,143 @@
+package gowebsocket
+
+import "sync"
+
+type unackedMessage struct {
+	id          uint64
+	messageType int
+	data        []byte
+}
+
+// unackedMessages holds written messages, in ID order, until they are
+// acknowledged.
+type unackedMessages struct {
+	mu       sync.Mutex
+	messages []unackedMessage
+	bytes    int
+	acked    chan struct{} // Closed and replaced when Ack removes a message
+}
+
+// add holds a written message. A message resent after a reconnect is held
+// already and is not added twice.
+func (unacked *unackedMessages) add(id uint64, messageType int, data []byte) {
+	unacked.mu.Lock()
+	defer unacked.mu.Unlock()
+	if n := len(unacked.messages); n > 0 && id <= unacked.messages[n-1].id {
+		for _, message := range unacked.messages {
+			if message.id == id {
+				return
+			}
+		}
+	}
+	unacked.messages = append(unacked.messages, unackedMessage{id, messageType, append([]byte(nil), data...)})
+	unacked.bytes += len(data)
+}
+
+func (unacked *unackedMessages) len() int {
+	unacked.mu.Lock()
+	defer unacked.mu.Unlock()
+	return len(unacked.messages)
+}
+
+// ackedChan returns a channel that is closed by the next Ack that removes a
+// message.
+func (unacked *unackedMessages) ackedChan() <-chan struct{} {
+	unacked.mu.Lock()
+	defer unacked.mu.Unlock()
+	if unacked.acked == nil {
+		unacked.acked = make(chan struct{})
+	}
+	return unacked.acked
+}
+
+func (unacked *unackedMessages) pending() []unackedMessage {
+	unacked.mu.Lock()
+	defer unacked.mu.Unlock()
+	return append([]unackedMessage(nil), unacked.messages...)
+}
+
+// Ack marks the message with the given ID as acknowledged by the peer so it
+// is not resent after a reconnect and no longer counts against AckWindow.
+// It only has an effect with ResendUnackedOnReconnect or AckWindow.
+func (socket *Socket) Ack(id uint64) {
+	unacked := socket.unacked
+	unacked.mu.Lock()
+	defer unacked.mu.Unlock()
+	for i, message := range unacked.messages {
+		if message.id == id {
+			unacked.bytes -= len(message.data)
+			unacked.messages = append(unacked.messages[:i], unacked.messages[i+1:]...)
+			if unacked.acked != nil {
+				close(unacked.acked)
+				unacked.acked = nil
+			}
+			return
+		}
+	}
+}
+
+// resendUnacked rewrites the unacknowledged messages after a reconnect. It
+// stops at the first failure, which is handled like that of a send; the
+// rest stay unacknowledged for the next reconnect.
+func (socket *Socket) resendUnacked() {
+	if !socket.ResendUnackedOnReconnect {
+		return
+	}
+	messages := socket.unacked.pending()
+	if len(messages) == 0 {
+		return
+	}
+
+	socket.sendMu.Lock()
+	for _, message := range messages {
+		if err := socket.write(message.id, message.messageType, message.data, nil); err != nil {
+			socket.sendMu.Unlock()
+			socket.writeFailed(err)
+			return
+		}
+	}
+	socket.sendMu.Unlock()
+	socket.log.info("Resent", len(messages), "unacknowledged messages")
+}
+
+// lockWithinWindow locks sendMu, for a data message only once fewer than
+// AckWindow messages are waiting for their Ack. Writes only happen under
+// sendMu, so the count cannot grow before the message is written.
+func (socket *Socket) lockWithinWindow(messageType int) error {
+	if socket.AckWindow <= 0 || !isDataMessage(messageType) {
+		socket.sendMu.Lock()
+		return nil
+	}
+	for {
+		acked := socket.unacked.ackedChan()
+		socket.sendMu.Lock()
+		if socket.unacked.len() < socket.AckWindow {
+			return nil
+		}
+		socket.sendMu.Unlock()
+		select {
+		case <-acked:
+		case <-socket.done:
+			return ErrClosed
+		}
+	}
+}
+
+// waitForWindow is lockWithinWindow for a caller already holding sendMu,
+// which it keeps while waiting so that no other send gets in first.
+func (socket *Socket) waitForWindow() error {
+	if socket.AckWindow <= 0 {
+		return nil
+	}
+	for {
+		acked := socket.unacked.ackedChan()
+		if socket.unacked.len() < socket.AckWindow {
+			return nil
+		}
+		select {
+		case <-acked:
+		case <-socket.done:
+			return ErrClosed
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gowebsocket
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestResendUnackedOnReconnect(t *testing.T) {
+	var connections int32
+	drop := make(chan struct{})
+	resent := make(chan string, 10)
+	_, url := startServer(t, func(conn *websocket.Conn) {
+		if atomic.AddInt32(&connections, 1) == 1 {
+			for i := 0; i < 5; i++ {
+				conn.ReadMessage()
+			}
+			<-drop
+			return
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			resent <- string(data)
+		}
+	})
+	socket := New(url)
+	socket.ResendUnackedOnReconnect = true
+	socket.ReconnectionOptions.Interval = time.Millisecond
+	if err := socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	for _, message := range []string{"1", "2", "3", "4", "5"} {
+		if err := socket.SendText(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := uint64(1); id <= 3; id++ {
+		socket.Ack(id)
+	}
+	close(drop)
+
+	for _, want := range []string{"4", "5"} {
+		select {
+		case got := <-resent:
+			if got != want {
+				t.Fatalf("resent %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q was not resent", want)
+		}
+	}
+	select {
+	case got := <-resent:
+		t.Fatalf("unexpected resend of %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if sent := socket.Stats().MessagesSent; sent != 7 {
+		t.Fatalf("MessagesSent = %d, want 7 including the resends", sent)
+	}
+
+	// The resent messages are still held until acknowledged.
+	socket.Ack(4)
+	socket.Ack(5)
+	if _, tx := socket.BufferedBytes(); tx != 0 {
+		t.Fatalf("%d bytes still unacknowledged", tx)
+	}
+}
@@ -0,0 +1,33 @@
+package gowebsocket
+
+import "testing"
+
+func TestNewValidated(t *testing.T) {
+	for _, url := range []string{
+		"ws://example.com",
+		"wss://example.com:8443/socket?token=x",
+		"ws://127.0.0.1:8080/",
+	} {
+		socket, err := NewValidated(url)
+		if err != nil {
+			t.Errorf("NewValidated(%q) = %v", url, err)
+			continue
+		}
+		if socket.Url != url {
+			t.Errorf("NewValidated(%q) set Url %q", url, socket.Url)
+		}
+	}
+	for _, url := range []string{
+		"http://example.com",
+		"https://example.com",
+		"example.com",
+		"ws://",
+		"ws:///path",
+		"",
+		"ws://exa mple.com",
+	} {
+		if _, err := NewValidated(url); err == nil {
+			t.Errorf("NewValidated(%q) accepted the URL", url)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package gowebsocket
+
+import "sync"
+
+// activity counts the socket's running receive and reconnect loops so that
+// Wait can block until there are none.
+type activity struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // Closed when n drops to zero
+}
+
+func (a *activity) begin() {
+	a.mu.Lock()
+	if a.n == 0 {
+		a.idle = make(chan struct{})
+	}
+	a.n++
+	a.mu.Unlock()
+}
+
+func (a *activity) end() {
+	a.mu.Lock()
+	a.n--
+	if a.n == 0 {
+		close(a.idle)
+	}
+	a.mu.Unlock()
+}
+
+func (a *activity) wait() {
+	a.mu.Lock()
+	idle := a.idle
+	n := a.n
+	a.mu.Unlock()
+	if n > 0 {
+		<-idle
+	}
+}
+
+// Wait blocks until the socket has stopped: no receive loop is running and
+// no reconnect is in progress, because the socket was closed, gave up
+// reconnecting or never connected. Unlike Done, which is closed as soon as
+// Close is called, it returns only once that work has finished, so it suits
+// tests and shutting down before main returns. It must not be called from
+// the socket's callbacks, which run on the goroutines it waits for.
+func (socket *Socket) Wait() {
+	socket.running.wait()
+}